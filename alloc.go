@@ -6,8 +6,12 @@ type Allocator struct {
 	Sectors        *Sectors
 	DifatSectorIds []uint32
 	Difat          []uint32
-	Fat            []uint32
-	Validation     Validation
+	// Fat is the whole FAT, or nil if it is loaded lazily; FatLen and
+	// FatEntry work either way.
+	Fat        []uint32
+	Validation Validation
+
+	lazyFat *lazyFat
 }
 
 func NewAllocator(sector *Sectors, difatSectorIds []uint32, difat []uint32, fat []uint32, validation Validation) (*Allocator, error) {
@@ -29,13 +33,47 @@ func NewAllocator(sector *Sectors, difatSectorIds []uint32, difat []uint32, fat
 	return &alloc, nil
 }
 
+// Creates an allocator that reads FAT sectors as they are needed. The FAT
+// isn't validated as a whole, as that would mean reading all of it.
+func newLazyAllocator(sectors *Sectors, difatSectorIds []uint32, difat []uint32, fat *lazyFat, validation Validation) *Allocator {
+	return &Allocator{
+		Sectors:        sectors,
+		DifatSectorIds: difatSectorIds,
+		Difat:          difat,
+		Validation:     validation,
+		lazyFat:        fat,
+	}
+}
+
+// Returns the number of entries in the FAT.
+func (a *Allocator) FatLen() uint32 {
+	return a.fatTable().Len()
+}
+
+// Returns the FAT entry of a sector, reading it from the file if the FAT is
+// loaded lazily.
+func (a *Allocator) FatEntry(sectorId uint32) (uint32, error) {
+	return a.fatTable().Entry(sectorId)
+}
+
+func (a *Allocator) fatTable() allocTable {
+	if a.lazyFat != nil {
+		return a.lazyFat
+	}
+
+	return sliceTable(a.Fat)
+}
+
 func (a *Allocator) Next(index uint32) (uint32, error) {
-	if index > uint32(len(a.Fat)) {
+	if index >= a.FatLen() {
 		return 0, fmt.Errorf("invalid index: %v", index)
 	}
 
-	nextId := a.Fat[index]
-	if nextId != END_OF_CHAIN && (nextId > MAX_REGULAR_SECTOR || nextId >= uint32(len(a.Fat))) {
+	nextId, err := a.FatEntry(index)
+	if err != nil {
+		return 0, err
+	}
+	if nextId != END_OF_CHAIN && (nextId > MAX_REGULAR_SECTOR || nextId >= a.FatLen()) {
 		return 0, fmt.Errorf("invalid next index: %v", nextId)
 	}
 
@@ -0,0 +1,364 @@
+package mscfb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+	"testing"
+	"unicode/utf16"
+)
+
+// testEntry describes a storage or stream to be written by testFile.build.
+// Parent storages are created implicitly.
+type testEntry struct {
+	path    string
+	storage bool
+	data    []byte
+	// orphan leaves the entry's slot and data in place but marks it
+	// unallocated and unlinks it from the tree, as deleting it would.
+	orphan bool
+}
+
+// testFile lays out a minimal, well-formed compound file in memory. Zero
+// values select the defaults for the version.
+type testFile struct {
+	version     Version
+	sectorShift uint16
+	miniShift   uint16
+	cutoff      uint32
+	metaFirst   bool
+	entries     []testEntry
+}
+
+type testDirEntry struct {
+	name     string
+	objType  ObjectType
+	left     uint32
+	right    uint32
+	child    uint32
+	start    uint32
+	size     uint64
+	data     []byte
+	children []uint32
+	orphan   bool
+}
+
+// testImage is the result of building a testFile.
+type testImage struct {
+	data      []byte
+	sectorLen int
+	dirIds    map[string]uint32
+	dirStart  uint32
+	fatStart  uint32
+}
+
+func (i *testImage) sectorOffset(sectorId uint32) int {
+	return int(sectorId+1) * i.sectorLen
+}
+
+func (f testFile) build(tb testing.TB) *testImage {
+	tb.Helper()
+
+	version := f.version
+	if version == 0 {
+		version = V3
+	}
+	sectorShift := f.sectorShift
+	if sectorShift == 0 {
+		sectorShift = version.SectorShift()
+	}
+	miniShift := f.miniShift
+	if miniShift == 0 {
+		miniShift = MINI_SECTOR_SHIFT
+	}
+	cutoff := f.cutoff
+	if cutoff == 0 {
+		cutoff = MINI_STREAM_CUTOFF
+	}
+	sectorLen := 1 << int(sectorShift)
+	miniLen := 1 << int(miniShift)
+
+	// Directory tree.
+	dir := []*testDirEntry{{name: ROOT_DIR_NAME, objType: ObjRoot, child: NO_STREAM, left: NO_STREAM, right: NO_STREAM}}
+	ids := map[string]uint32{"/": ROOT_STREAM_ID}
+	var lookup func(names []string, storage bool, orphan bool) uint32
+	lookup = func(names []string, storage bool, orphan bool) uint32 {
+		p := PathFromNameChain(names)
+		if id, ok := ids[p]; ok {
+			return id
+		}
+		parent := lookup(names[:len(names)-1], true, false)
+		objType := ObjStream
+		if storage {
+			objType = ObjStorage
+		}
+		id := uint32(len(dir))
+		dir = append(dir, &testDirEntry{name: names[len(names)-1], objType: objType, child: NO_STREAM, left: NO_STREAM, right: NO_STREAM, orphan: orphan})
+		if !orphan {
+			dir[parent].children = append(dir[parent].children, id)
+		}
+		ids[p] = id
+		return id
+	}
+	for _, e := range f.entries {
+		id := lookup(NameChainFromPath(e.path), e.storage, e.orphan)
+		dir[id].data = e.data
+		dir[id].size = uint64(len(e.data))
+	}
+
+	var balance func(children []uint32) uint32
+	balance = func(children []uint32) uint32 {
+		if len(children) == 0 {
+			return NO_STREAM
+		}
+		mid := len(children) / 2
+		id := children[mid]
+		dir[id].left = balance(children[:mid])
+		dir[id].right = balance(children[mid+1:])
+		return id
+	}
+	for _, e := range dir {
+		sort.Slice(e.children, func(i, j int) bool {
+			return CompareNames(dir[e.children[i]].name, dir[e.children[j]].name) == OrderLess
+		})
+		e.child = balance(e.children)
+	}
+
+	// Mini stream and MiniFAT.
+	var miniStream []byte
+	var minifat []uint32
+	var bigStreams []*testDirEntry
+	for _, e := range dir {
+		if e.objType != ObjStream {
+			continue
+		}
+		if e.size >= uint64(cutoff) {
+			bigStreams = append(bigStreams, e)
+			continue
+		}
+		if e.size == 0 {
+			e.start = END_OF_CHAIN
+			continue
+		}
+		e.start = uint32(len(minifat))
+		for off := 0; off < len(e.data); off += miniLen {
+			chunk := make([]byte, miniLen)
+			copy(chunk, e.data[off:])
+			miniStream = append(miniStream, chunk...)
+			minifat = append(minifat, uint32(len(minifat)+1))
+		}
+		minifat[len(minifat)-1] = END_OF_CHAIN
+	}
+	dir[0].data = miniStream
+	dir[0].size = uint64(len(miniStream))
+
+	minifatBytes := make([]byte, 4*len(minifat))
+	for i, v := range minifat {
+		binary.LittleEndian.PutUint32(minifatBytes[4*i:], v)
+	}
+	for len(minifatBytes)%sectorLen != 0 {
+		minifatBytes = append(minifatBytes, 0xff)
+	}
+
+	numDirSectors := (len(dir)*DIR_ENTRY_LEN + sectorLen - 1) / sectorLen
+	numSectorsFor := func(n int) int { return (n + sectorLen - 1) / sectorLen }
+
+	// FAT and DIFAT sizes depend on the total number of sectors, including
+	// their own.
+	numData := numDirSectors + numSectorsFor(len(minifatBytes)) + numSectorsFor(len(miniStream))
+	for _, e := range bigStreams {
+		numData += numSectorsFor(len(e.data))
+	}
+	entriesPerSector := sectorLen / 4
+	numFat, numDifat := 0, 0
+	for {
+		total := numData + numFat + numDifat
+		nf := (total + entriesPerSector - 1) / entriesPerSector
+		nd := 0
+		if nf > NUM_DIFAT_ENTRIES_IN_HEADER {
+			nd = (nf - NUM_DIFAT_ENTRIES_IN_HEADER + entriesPerSector - 2) / (entriesPerSector - 1)
+		}
+		if nf == numFat && nd == numDifat {
+			break
+		}
+		numFat, numDifat = nf, nd
+	}
+
+	// Sector allocation. By default data comes first and the FAT last, like
+	// most writers; metaFirst puts everything but the large streams first.
+	var sectors [][]byte
+	var fat []uint32
+	alloc := func(data []byte) uint32 {
+		if len(data) == 0 {
+			return END_OF_CHAIN
+		}
+		start := uint32(len(sectors))
+		for off := 0; off < len(data); off += sectorLen {
+			sector := make([]byte, sectorLen)
+			copy(sector, data[off:])
+			sectors = append(sectors, sector)
+			fat = append(fat, uint32(len(sectors)))
+		}
+		fat[len(fat)-1] = END_OF_CHAIN
+		return start
+	}
+	var fatStart, difatStart, dirStart, minifatStart uint32
+	allocFat := func() {
+		fatStart = uint32(len(sectors))
+		for i := 0; i < numFat; i++ {
+			sectors = append(sectors, nil)
+			fat = append(fat, FAT_SECTOR)
+		}
+		difatStart = uint32(len(sectors))
+		for i := 0; i < numDifat; i++ {
+			sectors = append(sectors, nil)
+			fat = append(fat, DIFAT_SECTOR)
+		}
+	}
+	allocMeta := func() {
+		dirStart = alloc(make([]byte, numDirSectors*sectorLen))
+		minifatStart = alloc(minifatBytes)
+		dir[0].start = alloc(miniStream)
+	}
+	if f.metaFirst {
+		allocFat()
+		allocMeta()
+	}
+	for _, e := range bigStreams {
+		e.start = alloc(e.data)
+	}
+	if !f.metaFirst {
+		allocMeta()
+		allocFat()
+	}
+	numMinifat := len(minifatBytes) / sectorLen
+
+	dirBytes := make([]byte, 0)
+	for _, e := range dir {
+		dirBytes = append(dirBytes, encodeTestDirEntry(e)...)
+	}
+	for len(dirBytes)%sectorLen != 0 {
+		dirBytes = append(dirBytes, encodeTestDirEntry(&testDirEntry{left: NO_STREAM, right: NO_STREAM, child: NO_STREAM})...)
+	}
+	for i := 0; i < numDirSectors; i++ {
+		copy(sectors[int(dirStart)+i], dirBytes[i*sectorLen:])
+	}
+
+	for len(fat) < numFat*entriesPerSector {
+		fat = append(fat, FREE_SECTOR)
+	}
+	fatIds := make([]uint32, numFat)
+	for i := range fatIds {
+		fatIds[i] = fatStart + uint32(i)
+		sector := make([]byte, sectorLen)
+		for j := 0; j < entriesPerSector; j++ {
+			binary.LittleEndian.PutUint32(sector[4*j:], fat[i*entriesPerSector+j])
+		}
+		sectors[fatIds[i]] = sector
+	}
+
+	remaining := fatIds
+	headerDifat := remaining
+	if len(headerDifat) > NUM_DIFAT_ENTRIES_IN_HEADER {
+		headerDifat = headerDifat[:NUM_DIFAT_ENTRIES_IN_HEADER]
+	}
+	remaining = remaining[len(headerDifat):]
+	for i := 0; i < numDifat; i++ {
+		sector := bytes.Repeat([]byte{0xff}, sectorLen)
+		n := entriesPerSector - 1
+		if n > len(remaining) {
+			n = len(remaining)
+		}
+		for j := 0; j < n; j++ {
+			binary.LittleEndian.PutUint32(sector[4*j:], remaining[j])
+		}
+		remaining = remaining[n:]
+		next := END_OF_CHAIN
+		if i+1 < numDifat {
+			next = difatStart + uint32(i+1)
+		}
+		binary.LittleEndian.PutUint32(sector[sectorLen-4:], next)
+		sectors[difatStart+uint32(i)] = sector
+	}
+
+	// Header.
+	header := make([]byte, sectorLen)
+	copy(header, MAGIC_NUMBER)
+	le := binary.LittleEndian
+	le.PutUint16(header[24:], uint16(MINOR_VERSION))
+	le.PutUint16(header[26:], uint16(version))
+	le.PutUint16(header[28:], BYTE_ORDER_MARK)
+	le.PutUint16(header[30:], sectorShift)
+	le.PutUint16(header[32:], miniShift)
+	if version == V4 {
+		le.PutUint32(header[40:], uint32(numDirSectors))
+	}
+	le.PutUint32(header[44:], uint32(numFat))
+	le.PutUint32(header[48:], dirStart)
+	le.PutUint32(header[56:], cutoff)
+	le.PutUint32(header[60:], minifatStart)
+	le.PutUint32(header[64:], uint32(numMinifat))
+	if numDifat > 0 {
+		le.PutUint32(header[68:], difatStart)
+	} else {
+		le.PutUint32(header[68:], END_OF_CHAIN)
+	}
+	le.PutUint32(header[72:], uint32(numDifat))
+	for i := 0; i < NUM_DIFAT_ENTRIES_IN_HEADER; i++ {
+		v := FREE_SECTOR
+		if i < len(headerDifat) {
+			v = headerDifat[i]
+		}
+		le.PutUint32(header[76+4*i:], v)
+	}
+
+	data := header
+	for _, sector := range sectors {
+		data = append(data, sector...)
+	}
+
+	return &testImage{
+		data:      data,
+		sectorLen: sectorLen,
+		dirIds:    ids,
+		dirStart:  dirStart,
+		fatStart:  fatStart,
+	}
+}
+
+func encodeTestDirEntry(e *testDirEntry) []byte {
+	buf := make([]byte, DIR_ENTRY_LEN)
+	le := binary.LittleEndian
+	if e.name != "" {
+		name := utf16.Encode([]rune(e.name))
+		for i, c := range name {
+			le.PutUint16(buf[2*i:], c)
+		}
+		le.PutUint16(buf[64:], uint16(2*(len(name)+1)))
+	}
+	buf[66] = e.objType.AsByte()
+	if e.orphan {
+		buf[66] = OBJ_TYPE_UNALLOCATED
+	}
+	buf[67] = COLOR_BLACK
+	le.PutUint32(buf[68:], e.left)
+	le.PutUint32(buf[72:], e.right)
+	le.PutUint32(buf[76:], e.child)
+	le.PutUint32(buf[116:], e.start)
+	le.PutUint64(buf[120:], e.size)
+	return buf
+}
+
+// testPattern returns n bytes of deterministic, non-repeating-per-sector
+// content so misplaced reads are detected.
+func testPattern(seed, n int) []byte {
+	data := make([]byte, n)
+	x := uint32(seed)*2654435761 + 1
+	for i := range data {
+		x ^= x << 13
+		x ^= x >> 17
+		x ^= x << 5
+		data[i] = byte(x)
+	}
+	return data
+}
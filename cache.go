@@ -0,0 +1,126 @@
+package mscfb
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// SectorCache decides which sectors of a file are kept in memory. The
+// sector's bytes are read by the compound file on a miss and offered to the
+// cache with Add; the cache may keep or drop them. Implementations must be
+// safe for concurrent use, and a cache must not be shared between files.
+type SectorCache interface {
+	// Get returns the bytes of a sector if they are cached. They must not
+	// be modified.
+	Get(sectorId uint32) ([]byte, bool)
+	// Add offers the bytes of a sector just read.
+	Add(sectorId uint32, data []byte)
+	// Usage returns the number of sectors held and their total size.
+	Usage() (sectors int, bytes int64)
+}
+
+// CacheStats reports how well the sector cache is doing.
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+	// Bytes and Sectors describe what the cache currently holds.
+	Bytes   int64
+	Sectors int
+}
+
+// sectorCache serves sectors through a SectorCache, counting hits and
+// misses.
+type sectorCache struct {
+	// Accessed atomically; kept first for 64-bit alignment.
+	hits   uint64
+	misses uint64
+	policy SectorCache
+}
+
+func newSectorCache(policy SectorCache) *sectorCache {
+	return &sectorCache{policy: policy}
+}
+
+// Returns the bytes of a sector present in the file, reading them on a miss.
+// The read is made without holding any lock, so concurrent misses on the
+// same sector may each read it.
+func (c *sectorCache) sector(s *Sectors, sectorId uint32) ([]byte, error) {
+	if data, ok := c.policy.Get(sectorId); ok {
+		atomic.AddUint64(&c.hits, 1)
+		return data, nil
+	}
+	atomic.AddUint64(&c.misses, 1)
+
+	data := make([]byte, s.available(sectorId))
+	if len(data) > 0 {
+		_, err := s.readAt(data, int64(sectorId+1)*int64(s.SectorLen()))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c.policy.Add(sectorId, data)
+	return data, nil
+}
+
+func (c *sectorCache) stats() CacheStats {
+	sectors, bytes := c.policy.Usage()
+
+	return CacheStats{
+		Hits:    atomic.LoadUint64(&c.hits),
+		Misses:  atomic.LoadUint64(&c.misses),
+		Bytes:   bytes,
+		Sectors: sectors,
+	}
+}
+
+// Returns the sector cache's statistics, or zero values if the file was
+// opened without one.
+func (c *CompoundFile) CacheStats() CacheStats {
+	cache := c.Directory.Allocator.Sectors.cache
+	if cache == nil {
+		return CacheStats{}
+	}
+
+	return cache.stats()
+}
+
+// lruSectorCache is the default SectorCache, keeping the least recently
+// used sectors up to a total size in bytes.
+type lruSectorCache struct {
+	mu  sync.Mutex
+	lru *lru
+}
+
+// Returns a SectorCache that keeps recently used sectors, evicting the
+// least recently used ones to stay within capacity bytes. This is the cache
+// OpenOptions.SectorCacheBytes sets up.
+func NewLRUSectorCache(capacity int64) SectorCache {
+	return &lruSectorCache{lru: newLRU(capacity)}
+}
+
+func (c *lruSectorCache) Get(sectorId uint32) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, ok := c.lru.get(uint64(sectorId))
+	if !ok {
+		return nil, false
+	}
+
+	return data.([]byte), true
+}
+
+func (c *lruSectorCache) Add(sectorId uint32, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.add(uint64(sectorId), data, int64(len(data)))
+}
+
+func (c *lruSectorCache) Usage() (int, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.len(), c.lru.used
+}
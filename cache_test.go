@@ -0,0 +1,186 @@
+package mscfb
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSectorCache(t *testing.T) {
+	entries := []testEntry{
+		{path: "/small", data: testPattern(1, 100)},
+		{path: "/other", data: testPattern(2, 3000)},
+		{path: "/large", data: testPattern(3, 20000)},
+	}
+
+	for _, version := range []Version{V3, V4} {
+		img := testFile{version: version, entries: entries}.build(t)
+		capacity := int64(4 * img.sectorLen)
+		cf, err := OpenWithOptions(bytes.NewReader(img.data), OpenOptions{
+			Validation:       ValidationStrict,
+			SectorCacheBytes: capacity,
+		})
+		if err != nil {
+			t.Fatalf("OpenWithOptions() error = %v", err)
+		}
+
+		for round := 0; round < 2; round++ {
+			for _, e := range entries {
+				stream, err := cf.OpenStream(e.path)
+				if err != nil {
+					t.Fatalf("OpenStream(%v) error = %v", e.path, err)
+				}
+				got, err := io.ReadAll(stream)
+				if err != nil {
+					t.Fatalf("ReadAll(%v) error = %v", e.path, err)
+				}
+				if !bytes.Equal(got, e.data) {
+					t.Errorf("v%v %v: read %v bytes not matching the stream", version, e.path, len(got))
+				}
+			}
+		}
+
+		stats := cf.CacheStats()
+		if stats.Hits == 0 || stats.Misses == 0 {
+			t.Errorf("v%v: CacheStats() = %+v, want both hits and misses", version, stats)
+		}
+		if stats.Bytes > capacity || stats.Sectors > 4 {
+			t.Errorf("v%v: CacheStats() = %+v, want at most %v bytes", version, stats, capacity)
+		}
+	}
+}
+
+// mapSectorCache keeps every sector, counting the calls made to it.
+type mapSectorCache struct {
+	mu      sync.Mutex
+	sectors map[uint32][]byte
+	adds    int
+}
+
+func (c *mapSectorCache) Get(sectorId uint32) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, ok := c.sectors[sectorId]
+	return data, ok
+}
+
+func (c *mapSectorCache) Add(sectorId uint32, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.adds++
+	c.sectors[sectorId] = data
+}
+
+func (c *mapSectorCache) Usage() (int, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var bytes int64
+	for _, data := range c.sectors {
+		bytes += int64(len(data))
+	}
+	return len(c.sectors), bytes
+}
+
+func TestSectorCachePolicy(t *testing.T) {
+	entries := []testEntry{
+		{path: "/small", data: testPattern(1, 100)},
+		{path: "/large", data: testPattern(2, 20000)},
+	}
+	img := testFile{entries: entries}.build(t)
+	cache := &mapSectorCache{sectors: make(map[uint32][]byte)}
+	cf, err := OpenWithOptions(bytes.NewReader(img.data), OpenOptions{SectorCache: cache, SectorCacheBytes: 1})
+	if err != nil {
+		t.Fatalf("OpenWithOptions() error = %v", err)
+	}
+
+	for round := 0; round < 2; round++ {
+		for _, e := range entries {
+			stream, err := cf.OpenStream(e.path)
+			if err != nil {
+				t.Fatalf("OpenStream(%v) error = %v", e.path, err)
+			}
+			got, err := io.ReadAll(stream)
+			if err != nil {
+				t.Fatalf("ReadAll(%v) error = %v", e.path, err)
+			}
+			if !bytes.Equal(got, e.data) {
+				t.Errorf("%v: read %v bytes not matching the stream", e.path, len(got))
+			}
+		}
+	}
+
+	// The cache keeps everything, so every sector is read once.
+	stats := cf.CacheStats()
+	if stats.Misses != uint64(cache.adds) || stats.Sectors != cache.adds || stats.Hits == 0 {
+		t.Errorf("CacheStats() = %+v with %v sectors added", stats, cache.adds)
+	}
+}
+
+// gatedReader blocks reads at one offset until released.
+type gatedReader struct {
+	*bytes.Reader
+	offset  int64
+	blocked chan struct{}
+	release chan struct{}
+}
+
+func (r *gatedReader) ReadAt(p []byte, off int64) (int, error) {
+	if off == r.offset {
+		close(r.blocked)
+		<-r.release
+	}
+	return r.Reader.ReadAt(p, off)
+}
+
+// A miss reads the sector without holding up hits on other sectors.
+func TestSectorCacheReadUnlocked(t *testing.T) {
+	img := testFile{entries: []testEntry{
+		{path: "/large", data: testPattern(1, 20000)},
+	}}.build(t)
+	reader := &gatedReader{
+		Reader:  bytes.NewReader(img.data),
+		offset:  -1,
+		blocked: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	cf, err := OpenWithOptions(reader, OpenOptions{SectorCacheBytes: 1 << 20})
+	if err != nil {
+		t.Fatalf("OpenWithOptions() error = %v", err)
+	}
+	sectors := cf.Directory.Allocator.Sectors
+	if _, err := sectors.cache.sector(sectors, 0); err != nil {
+		t.Fatalf("sector(0) error = %v", err)
+	}
+
+	reader.offset = int64(2 * img.sectorLen)
+	done := make(chan error)
+	go func() {
+		_, err := sectors.cache.sector(sectors, 1)
+		done <- err
+	}()
+	<-reader.blocked
+
+	hit := make(chan error)
+	go func() {
+		_, err := sectors.cache.sector(sectors, 0)
+		hit <- err
+	}()
+	select {
+	case err := <-hit:
+		if err != nil {
+			t.Errorf("sector(0) error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("cache hit waited for a miss being read")
+	}
+
+	close(reader.release)
+	if err := <-done; err != nil {
+		t.Errorf("sector(1) error = %v", err)
+	}
+}
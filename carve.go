@@ -0,0 +1,190 @@
+package mscfb
+
+import (
+	"fmt"
+	"sort"
+)
+
+// SectorRun is a group of sectors, or mini sectors, that no reachable
+// structure claims. The sectors are in the order given by the FAT (or
+// MiniFAT) entries they still hold, so a run is a candidate for a stream
+// that has since been deleted.
+type SectorRun struct {
+	Mini      bool
+	SectorIds []uint32
+}
+
+// Returns runs of the regular sectors not claimed by the DIFAT, FAT, MiniFAT,
+// directory, mini stream or any reachable stream. If one of those chains is
+// broken, the sectors past the break can't be told apart from unreferenced
+// ones; the runs are then returned along with the chain's error, and should
+// be treated as possibly including claimed sectors.
+func (c *CompoundFile) UnreferencedSectors() ([]*SectorRun, error) {
+	if err := c.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	claimed, err := c.claimedSectors()
+	if claimed == nil {
+		return nil, err
+	}
+
+	return groupSectorRuns(claimed, c.Directory.Allocator.fatTable(), false), err
+}
+
+// Returns runs of the mini sectors within the mini stream not claimed by any
+// reachable stream. As with UnreferencedSectors, a broken MiniFAT chain is
+// reported along with runs that may include claimed mini sectors.
+func (c *CompoundFile) UnreferencedMiniSectors() ([]*SectorRun, error) {
+	if err := c.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	claimed, err := c.claimedMiniSectors()
+
+	return groupSectorRuns(claimed, sliceTable(c.MiniAlloc.Minifat), true), err
+}
+
+// Reads the contents of every sector in a run, in order.
+func (c *CompoundFile) ReadSectorRun(run *SectorRun) ([]byte, error) {
+	if err := c.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	return c.readSectors(run.SectorIds, run.Mini)
+}
+
+// Reads whole sectors, or mini sectors, one after another.
+func (c *CompoundFile) readSectors(sectorIds []uint32, mini bool) ([]byte, error) {
+	sectorLen := c.Directory.Allocator.Sectors.SectorLen()
+	if mini {
+		sectorLen = c.MiniAlloc.MiniSectorLen
+	}
+
+	data := make([]byte, 0, len(sectorIds)*sectorLen)
+	buf := make([]byte, sectorLen)
+	for _, sectorId := range sectorIds {
+		var sector *Sector
+		var err error
+		if mini {
+			sector, err = c.MiniAlloc.SeekWithinMiniSector(sectorId, 0)
+		} else {
+			sector, err = c.Directory.Allocator.SeekToSector(sectorId)
+		}
+		if err != nil {
+			return data, err
+		}
+
+		n, err := readFullSector(sector, buf)
+		data = append(data, buf[:n]...)
+		if err != nil {
+			return data, err
+		}
+	}
+
+	return data, nil
+}
+
+// Marks every regular sector claimed by a reachable structure. Chains are
+// followed leniently, so a broken chain claims the sectors up to the break;
+// the first such break is returned. If the directory can't be walked at
+// all, nothing is returned but the error.
+func (c *CompoundFile) claimedSectors() ([]bool, error) {
+	numSectors := c.Directory.Allocator.Sectors.NumSectors
+	claimed := make([]bool, numSectors)
+	var firstErr error
+	err := c.visitClaimedChains(func(_ SectorClaim, sectorIds []uint32, err error) {
+		for _, sectorId := range sectorIds {
+			if sectorId < numSectors {
+				claimed[sectorId] = true
+			}
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return claimed, firstErr
+}
+
+// Marks every mini sector claimed by a reachable stream, like
+// claimedSectors.
+func (c *CompoundFile) claimedMiniSectors() ([]bool, error) {
+	numMiniSectors := uint32(c.Directory.RootDirEntry().StreamSize / uint64(c.MiniAlloc.MiniSectorLen))
+	claimed := make([]bool, numMiniSectors)
+	var firstErr error
+
+	for id := range c.Directory.reachableIds() {
+		dirEntry := c.Directory.DirEntries[id]
+		if dirEntry.ObjType != ObjStream || dirEntry.StreamSize == 0 || !c.isMiniStream(dirEntry) {
+			continue
+		}
+
+		sectorIds, err := followChain(sliceTable(c.MiniAlloc.Minifat), dirEntry.StartingSector, numMiniSectors, 0)
+		for _, sectorId := range sectorIds {
+			claimed[sectorId] = true
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("stream %v: %w", id, err)
+		}
+	}
+
+	return claimed, firstErr
+}
+
+// Groups the unclaimed sectors into runs by following the links they hold in
+// table. Runs start at sectors no other unclaimed sector links to, in sector
+// order; sectors left over (links forming a cycle) start runs of their own.
+func groupSectorRuns(claimed []bool, table allocTable, mini bool) []*SectorRun {
+	next := func(sectorId uint32) (uint32, bool) {
+		nextId, err := table.Entry(sectorId)
+		if err != nil || nextId >= uint32(len(claimed)) || claimed[nextId] {
+			return 0, false
+		}
+		return nextId, true
+	}
+
+	linkedTo := make(map[uint32]bool)
+	unclaimed := make([]uint32, 0)
+	for sectorId := range claimed {
+		if claimed[sectorId] {
+			continue
+		}
+		unclaimed = append(unclaimed, uint32(sectorId))
+		if nextId, ok := next(uint32(sectorId)); ok {
+			linkedTo[nextId] = true
+		}
+	}
+
+	heads := make([]uint32, 0, len(unclaimed))
+	for _, sectorId := range unclaimed {
+		if !linkedTo[sectorId] {
+			heads = append(heads, sectorId)
+		}
+	}
+	heads = append(heads, unclaimed...)
+
+	visited := make(map[uint32]bool)
+	runs := make([]*SectorRun, 0)
+	for _, head := range heads {
+		if visited[head] {
+			continue
+		}
+
+		run := &SectorRun{Mini: mini}
+		for sectorId, ok := head, true; ok && !visited[sectorId]; sectorId, ok = next(sectorId) {
+			visited[sectorId] = true
+			run.SectorIds = append(run.SectorIds, sectorId)
+		}
+		runs = append(runs, run)
+	}
+
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].SectorIds[0] < runs[j].SectorIds[0]
+	})
+
+	return runs
+}
@@ -0,0 +1,115 @@
+package mscfb
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestUnreferencedSectors(t *testing.T) {
+	small := testPattern(1, 200)
+	large := testPattern(2, 6000)
+	img := testFile{
+		version: V3,
+		entries: []testEntry{
+			{path: "/kept small", data: testPattern(3, 100)},
+			{path: "/kept large", data: testPattern(4, 5000)},
+			{path: "/deleted small", data: small, orphan: true},
+			{path: "/deleted large", data: large, orphan: true},
+		},
+	}.build(t)
+
+	cf, err := Open(bytes.NewReader(img.data), ValidationPermissive)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	// Besides the deleted stream, the free tail of the last FAT sector is
+	// past the end of the file and so isn't counted.
+	runs, err := cf.UnreferencedSectors()
+	if err != nil {
+		t.Fatalf("UnreferencedSectors() error = %v", err)
+	}
+	if len(runs) != 1 {
+		t.Fatalf("UnreferencedSectors() returned %v runs, want 1", len(runs))
+	}
+	data, err := cf.ReadSectorRun(runs[0])
+	if err != nil {
+		t.Fatalf("ReadSectorRun() error = %v", err)
+	}
+	if len(data) != 12*512 || !bytes.Equal(data[:len(large)], large) {
+		t.Errorf("ReadSectorRun() returned %v bytes not matching the deleted stream", len(data))
+	}
+
+	miniRuns, err := cf.UnreferencedMiniSectors()
+	if err != nil {
+		t.Fatalf("UnreferencedMiniSectors() error = %v", err)
+	}
+	if len(miniRuns) != 1 || !miniRuns[0].Mini {
+		t.Fatalf("UnreferencedMiniSectors() returned %v runs, want 1", len(miniRuns))
+	}
+	data, err = cf.ReadSectorRun(miniRuns[0])
+	if err != nil {
+		t.Fatalf("ReadSectorRun() error = %v", err)
+	}
+	if len(data) != 4*64 || !bytes.Equal(data[:len(small)], small) {
+		t.Errorf("ReadSectorRun() returned %v bytes not matching the deleted stream", len(data))
+	}
+}
+
+func TestGroupSectorRuns(t *testing.T) {
+	claimed := []bool{true, false, false, false, false, false, true}
+	table := sliceTable{END_OF_CHAIN, 4, FREE_SECTOR, 5, 3, 4, END_OF_CHAIN}
+
+	runs := groupSectorRuns(claimed, table, false)
+	want := [][]uint32{{1, 4, 3, 5}, {2}}
+	if len(runs) != len(want) {
+		t.Fatalf("groupSectorRuns() returned %v runs, want %v", len(runs), len(want))
+	}
+	for i, run := range runs {
+		if len(run.SectorIds) != len(want[i]) {
+			t.Fatalf("run %v = %v, want %v", i, run.SectorIds, want[i])
+		}
+		for j := range run.SectorIds {
+			if run.SectorIds[j] != want[i][j] {
+				t.Errorf("run %v = %v, want %v", i, run.SectorIds, want[i])
+			}
+		}
+	}
+}
+
+// A broken chain leaves the sectors past the break looking unreferenced, so
+// the error is reported along with the runs.
+func TestUnreferencedSectorsBrokenChain(t *testing.T) {
+	img := testFile{
+		version: V3,
+		entries: []testEntry{
+			{path: "/small", data: testPattern(1, 300)},
+			{path: "/large", data: testPattern(2, 5000)},
+		},
+	}.build(t)
+
+	cf, err := Open(bytes.NewReader(img.data), ValidationPermissive)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	large := cf.Directory.DirEntries[img.dirIds["/large"]].StartingSector
+	cf.Directory.Allocator.Fat[large] = MAX_REGULAR_SECTOR + 1
+	small := cf.Directory.DirEntries[img.dirIds["/small"]].StartingSector
+	cf.MiniAlloc.Minifat[small] = uint32(len(cf.MiniAlloc.Minifat)) + 100
+
+	runs, err := cf.UnreferencedSectors()
+	if err == nil {
+		t.Errorf("UnreferencedSectors() error = nil, want the broken chain")
+	}
+	if len(runs) != 1 || len(runs[0].SectorIds) != 9 {
+		t.Errorf("UnreferencedSectors() = %v runs, want the 9 sectors past the break", len(runs))
+	}
+
+	miniRuns, err := cf.UnreferencedMiniSectors()
+	if err == nil {
+		t.Errorf("UnreferencedMiniSectors() error = nil, want the broken chain")
+	}
+	if len(miniRuns) != 1 || len(miniRuns[0].SectorIds) != 4 {
+		t.Errorf("UnreferencedMiniSectors() = %v runs, want the 4 mini sectors past the break", len(miniRuns))
+	}
+}
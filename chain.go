@@ -16,6 +16,13 @@ func NewChain(allocator *Allocator, startingSectorId uint32, init SectorInit) (*
 	sectorIds := make([]uint32, 0)
 	currentSectorId := startingSectorId
 
+	// A lazily loaded FAT isn't validated as a whole, so cycles are caught
+	// here, with Brent's algorithm: each sector id is compared with the one
+	// saved after the last power of two steps, which finds a cycle within a
+	// few times its length without remembering every sector visited.
+	savedSectorId := startingSectorId
+	power, steps := 1, 0
+
 	var err error
 	for currentSectorId != END_OF_CHAIN {
 		sectorIds = append(sectorIds, currentSectorId)
@@ -24,9 +31,15 @@ func NewChain(allocator *Allocator, startingSectorId uint32, init SectorInit) (*
 			return nil, err
 		}
 
-		if currentSectorId == startingSectorId {
+		if currentSectorId == savedSectorId {
 			return nil, fmt.Errorf("chain contained duplicate sector id %v", currentSectorId)
 		}
+		steps++
+		if steps == power {
+			savedSectorId = currentSectorId
+			power *= 2
+			steps = 0
+		}
 	}
 
 	return &Chain{
@@ -119,6 +132,12 @@ func (c *Chain) IntoSubSector(subSectorIndex uint32, subSectorLen int64, offsetW
 	subSectorPerSector := int64(c.Allocator.Sectors.SectorLen()) / subSectorLen
 	sectorIndexWithinChain := subSectorIndex / uint32(subSectorPerSector)
 	subsectorIndexWithinSector := subSectorIndex % uint32(subSectorPerSector)
+	// A chain cut short in recovery can end before the sub-sectors that
+	// point into it.
+	if sectorIndexWithinChain >= uint32(len(c.SectorIds)) {
+		return nil, fmt.Errorf("sub-sector %v is past the end of its %v-sector chain: %w",
+			subSectorIndex, len(c.SectorIds), ErrTruncated)
+	}
 	sectorId := c.SectorIds[sectorIndexWithinChain]
 
 	sector, err := c.Allocator.SeekWithinSubSector(sectorId, subsectorIndexWithinSector, subSectorLen, int64(offsetWithin))
@@ -128,3 +147,39 @@ func (c *Chain) IntoSubSector(subSectorIndex uint32, subSectorLen int64, offsetW
 
 	return sector, nil
 }
+
+// Follows a chain through a FAT or MiniFAT without failing on bad links,
+// stopping at the end of the chain, after maxLen sectors (if maxLen is
+// positive), or at the first link that is out of range or revisits a sector.
+// In the latter case the sectors gathered so far are returned with an error.
+func followChain(table allocTable, start uint32, limit uint32, maxLen int) ([]uint32, error) {
+	sectorIds := make([]uint32, 0)
+	seen := make(map[uint32]bool)
+
+	for current := start; current != END_OF_CHAIN; {
+		if maxLen > 0 && len(sectorIds) >= maxLen {
+			break
+		}
+
+		if current > MAX_REGULAR_SECTOR || current >= limit {
+			return sectorIds, fmt.Errorf("chain starting at %v breaks at invalid sector %v", start, current)
+		}
+		if seen[current] {
+			return sectorIds, fmt.Errorf("chain starting at %v revisits sector %v", start, current)
+		}
+		seen[current] = true
+		sectorIds = append(sectorIds, current)
+
+		if current >= table.Len() {
+			return sectorIds, fmt.Errorf("chain starting at %v runs past the allocation table at %v", start, current)
+		}
+
+		var err error
+		current, err = table.Entry(current)
+		if err != nil {
+			return sectorIds, err
+		}
+	}
+
+	return sectorIds, nil
+}
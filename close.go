@@ -0,0 +1,88 @@
+package mscfb
+
+import "io/fs"
+
+// Closes the compound file, dropping its reader and cached sectors. If it
+// owns the file behind it, as when opened with OpenFile or OpenStream or
+// with OpenOptions.OwnReader, that is closed too (and a temporary file
+// removed). Using the compound file or its streams afterwards fails with
+// fs.ErrClosed, and slices returned by Stream.Next must no longer be used.
+// Close must not be called while other goroutines are reading from it.
+func (c *CompoundFile) Close() error {
+	if c.closed {
+		return fs.ErrClosed
+	}
+	c.closed = true
+
+	sectors := c.Directory.Allocator.Sectors
+	sectors.data = nil
+	sectors.cache = nil
+	sectors.inner = closedReader{}
+	sectors.innerAt = nil
+	c.Reader = closedReader{}
+
+	if c.closer == nil {
+		return nil
+	}
+
+	closer := c.closer
+	c.closer = nil
+	return closer()
+}
+
+// Closes the stream, releasing its read buffer. Using it afterwards fails
+// with fs.ErrClosed, as does using a stream whose compound file is closed.
+// The compound file stays open, but embedded compound files opened by
+// OpenNestedStream to reach the stream are closed.
+func (s *Stream) Close() error {
+	if s.closed {
+		return fs.ErrClosed
+	}
+	s.closed = true
+
+	s.Buffer = nil
+	s.chain = nil
+	return closeEmbedded(s.embedded)
+}
+
+// Closes embedded compound files, innermost first since each one reads
+// through the file holding it. Returns the first error.
+func closeEmbedded(files []*CompoundFile) error {
+	var firstErr error
+	for i := len(files) - 1; i >= 0; i-- {
+		if err := files[i].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// Returns fs.ErrClosed if the compound file is closed.
+func (c *CompoundFile) checkOpen() error {
+	if c.closed {
+		return fs.ErrClosed
+	}
+
+	return nil
+}
+
+// Returns fs.ErrClosed if the stream or its compound file is closed.
+func (s *Stream) checkOpen() error {
+	if s.closed {
+		return fs.ErrClosed
+	}
+
+	return s.CompoundFile.checkOpen()
+}
+
+// closedReader stands in for the reader of a closed file.
+type closedReader struct{}
+
+func (closedReader) Read(p []byte) (int, error) {
+	return 0, fs.ErrClosed
+}
+
+func (closedReader) Seek(offset int64, whence int) (int64, error) {
+	return 0, fs.ErrClosed
+}
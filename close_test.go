@@ -0,0 +1,172 @@
+package mscfb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+)
+
+// closeCounter is a reader that counts calls to Close.
+type closeCounter struct {
+	*bytes.Reader
+	closes int
+}
+
+func (r *closeCounter) Close() error {
+	r.closes++
+	return nil
+}
+
+func TestClose(t *testing.T) {
+	entries := []testEntry{
+		{path: "/small", data: testPattern(1, 100)},
+		{path: "/large", data: testPattern(2, 5000)},
+	}
+	img := testFile{entries: entries}.build(t)
+
+	for _, own := range []bool{false, true} {
+		reader := &closeCounter{Reader: bytes.NewReader(img.data)}
+		cf, err := OpenWithOptions(reader, OpenOptions{OwnReader: own, SectorCacheBytes: 1 << 20})
+		if err != nil {
+			t.Fatalf("OpenWithOptions() error = %v", err)
+		}
+
+		small, err := cf.OpenStream("/small")
+		if err != nil {
+			t.Fatalf("OpenStream() error = %v", err)
+		}
+		large, err := cf.OpenStream("/large")
+		if err != nil {
+			t.Fatalf("OpenStream() error = %v", err)
+		}
+
+		// Closing a stream leaves the compound file and other streams open.
+		if err := small.Close(); err != nil {
+			t.Fatalf("Stream.Close() error = %v", err)
+		}
+		if _, err := small.Read(make([]byte, 10)); !errors.Is(err, fs.ErrClosed) {
+			t.Errorf("Read() after Stream.Close() error = %v, want %v", err, fs.ErrClosed)
+		}
+		if _, err := small.Seek(0, io.SeekStart); !errors.Is(err, fs.ErrClosed) {
+			t.Errorf("Seek() after Stream.Close() error = %v, want %v", err, fs.ErrClosed)
+		}
+		if err := small.Close(); !errors.Is(err, fs.ErrClosed) {
+			t.Errorf("second Stream.Close() error = %v, want %v", err, fs.ErrClosed)
+		}
+		if _, err := io.ReadFull(large, make([]byte, 10)); err != nil {
+			t.Fatalf("ReadFull() error = %v", err)
+		}
+
+		if err := cf.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+		if want := map[bool]int{false: 0, true: 1}[own]; reader.closes != want {
+			t.Errorf("OwnReader %v: reader closed %v times, want %v", own, reader.closes, want)
+		}
+
+		// Sectors read before aren't served from the cache any more.
+		if _, err := io.ReadAll(large); !errors.Is(err, fs.ErrClosed) {
+			t.Errorf("ReadAll() after Close() error = %v, want %v", err, fs.ErrClosed)
+		}
+		if _, err := cf.OpenStream("/small"); !errors.Is(err, fs.ErrClosed) {
+			t.Errorf("OpenStream() after Close() error = %v, want %v", err, fs.ErrClosed)
+		}
+		walk := cf.Walk()
+		if entry := walk.Next(); entry != nil || !errors.Is(walk.Err(), fs.ErrClosed) {
+			t.Errorf("Walk() after Close() = %v, %v, want nil, %v", entry, walk.Err(), fs.ErrClosed)
+		}
+		if err := cf.Close(); !errors.Is(err, fs.ErrClosed) {
+			t.Errorf("second Close() error = %v, want %v", err, fs.ErrClosed)
+		}
+	}
+}
+
+// Every method reading a closed file reports fs.ErrClosed rather than
+// answering from what is left in memory.
+func TestClosedFileMethods(t *testing.T) {
+	img := testFile{entries: []testEntry{
+		{path: "/small", data: testPattern(1, 100)},
+		{path: "/storage/large", data: testPattern(2, 5000)},
+	}}.build(t)
+	open := func() *CompoundFile {
+		cf, err := Open(bytes.NewReader(img.data), ValidationStrict)
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		return cf
+	}
+	other := open()
+	cf := open()
+	stream, err := cf.OpenStream("/storage/large")
+	if err != nil {
+		t.Fatalf("OpenStream() error = %v", err)
+	}
+	if err := cf.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	ignore := func(_ interface{}, err error) error { return err }
+	walkErr := func(entries *Entries) error {
+		for entries.Next() != nil {
+		}
+		return entries.Err()
+	}
+	nestedErr := func(entries *NestedEntries) error {
+		for entries.Next() != nil {
+		}
+		return entries.Err()
+	}
+	calls := map[string]error{
+		"Walk":                    walkErr(cf.Walk()),
+		"WalkContext":             walkErr(cf.WalkContext(context.Background())),
+		"WalkNested":              nestedErr(cf.WalkNested(NestedOptions{})),
+		"OpenStream":              ignore(cf.OpenStream("/small")),
+		"OpenStreamByNames":       ignore(cf.OpenStreamByNames([]string{"small"})),
+		"OpenNestedStream":        ignore(cf.OpenNestedStream("/small", NestedOptions{})),
+		"Exists":                  ignore(cf.Exists("/small")),
+		"IsStream":                ignore(cf.IsStream("/small")),
+		"Extents":                 ignore(cf.Extents("/storage/large")),
+		"StreamStatuses":          ignore(cf.StreamStatuses()),
+		"OrphanedEntries":         ignore(cf.OrphanedEntries()),
+		"UnreferencedSectors":     ignore(cf.UnreferencedSectors()),
+		"UnreferencedMiniSectors": ignore(cf.UnreferencedMiniSectors()),
+		"ReadSectorRun":           ignore(cf.ReadSectorRun(&SectorRun{SectorIds: []uint32{0}})),
+		"MiniStreamSlack":         ignore(cf.MiniStreamSlack()),
+		"DirectorySlack":          ignore(cf.DirectorySlack()),
+		"SectorMap":               ignore(cf.SectorMap()),
+		"Locate":                  ignore(cf.Locate(int64(3 * img.sectorLen))),
+		"Manifest":                ignore(cf.Manifest()),
+		"Diff(closed, open)":      ignore(Diff(cf, other)),
+		"Diff(open, closed)":      ignore(Diff(other, cf)),
+		"ExtractAll":              ignore(ExtractAll(cf, t.TempDir(), ExtractOptions{})),
+
+		"Stream.Read":             ignore(stream.Read(make([]byte, 10))),
+		"Stream.Seek":             ignore(stream.Seek(0, io.SeekStart)),
+		"Stream.Next":             ignore(stream.Next(10)),
+		"Stream.WriteTo":          ignore(stream.WriteTo(io.Discard)),
+		"Stream.WriteToContext":   ignore(stream.WriteToContext(context.Background(), io.Discard)),
+		"Stream.PhysicalExtents":  ignore(stream.PhysicalExtents()),
+		"Stream.Slack":            ignore(stream.Slack()),
+		"Stream.IsCompoundFile":   ignore(stream.IsCompoundFile()),
+		"Stream.OpenCompoundFile": ignore(stream.OpenCompoundFile(OpenOptions{})),
+	}
+	for name, err := range calls {
+		if !errors.Is(err, fs.ErrClosed) {
+			t.Errorf("%v after Close() error = %v, want %v", name, err, fs.ErrClosed)
+		}
+	}
+
+	// The stream itself can still be closed, once.
+	if stream.CurrentPosition() != 0 {
+		t.Errorf("CurrentPosition() = %v, want 0", stream.CurrentPosition())
+	}
+	if err := stream.Close(); err != nil {
+		t.Errorf("Stream.Close() error = %v", err)
+	}
+	if err := stream.Close(); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("second Stream.Close() error = %v, want %v", err, fs.ErrClosed)
+	}
+}
@@ -0,0 +1,74 @@
+package mscfb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+// cancelWriter cancels a context after its first write.
+type cancelWriter struct {
+	cancel context.CancelFunc
+	bytes.Buffer
+}
+
+func (w *cancelWriter) Write(p []byte) (int, error) {
+	w.cancel()
+	return w.Buffer.Write(p)
+}
+
+func TestContextCancelled(t *testing.T) {
+	entries := []testEntry{
+		{path: "/small", data: testPattern(1, 100)},
+		{path: "/storage/large", data: testPattern(2, 3<<20)},
+	}
+	img := testFile{version: V4, entries: entries, metaFirst: true}.build(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := OpenContext(ctx, bytes.NewReader(img.data), OpenOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("OpenContext() error = %v, want %v", err, context.Canceled)
+	}
+
+	cf, err := OpenContext(context.Background(), bytes.NewReader(img.data), OpenOptions{})
+	if err != nil {
+		t.Fatalf("OpenContext() error = %v", err)
+	}
+
+	walk := cf.WalkContext(ctx)
+	if entry := walk.Next(); entry != nil || !errors.Is(walk.Err(), context.Canceled) {
+		t.Errorf("WalkContext() = %v, %v, want nil, %v", entry, walk.Err(), context.Canceled)
+	}
+	if _, err := cf.ManifestContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("ManifestContext() error = %v, want %v", err, context.Canceled)
+	}
+	if _, err := ExtractAllContext(ctx, cf, t.TempDir(), ExtractOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("ExtractAllContext() error = %v, want %v", err, context.Canceled)
+	}
+
+	// Cancelling while the stream is copied stops after the current chunk.
+	stream, err := cf.OpenStream("/storage/large")
+	if err != nil {
+		t.Fatalf("OpenStream() error = %v", err)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	w := &cancelWriter{cancel: cancel}
+	n, err := stream.WriteToContext(ctx, w)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("WriteToContext() error = %v, want %v", err, context.Canceled)
+	}
+	if n != writeToChunkLen || !bytes.Equal(w.Bytes(), entries[1].data[:n]) {
+		t.Errorf("WriteToContext() wrote %v bytes, want the first %v", n, writeToChunkLen)
+	}
+
+	// The rest can still be read.
+	rest, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if !bytes.Equal(rest, entries[1].data[n:]) {
+		t.Errorf("ReadAll() after WriteToContext() returned %v bytes not matching the stream", len(rest))
+	}
+}
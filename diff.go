@@ -0,0 +1,329 @@
+package mscfb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"sort"
+)
+
+type ChangeKind int
+
+const (
+	ChangeAdded ChangeKind = iota
+	ChangeRemoved
+	ChangeRenamed
+	ChangeModified
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeRenamed:
+		return "renamed"
+	case ChangeModified:
+		return "modified"
+	default:
+		return "unknown"
+	}
+}
+
+// Names of the entry properties reported in Change.Fields.
+const (
+	FieldObjType      = "ObjType"
+	FieldCLSID        = "CLSID"
+	FieldStateBits    = "StateBits"
+	FieldCreationTime = "CreationTime"
+	FieldModifiedTime = "ModifiedTime"
+	FieldContent      = "Content"
+)
+
+// ByteRange is a run of bytes that differ between two versions of a stream.
+// A range past the end of the shorter version covers the bytes only the
+// longer one has.
+type ByteRange struct {
+	Offset uint64
+	Length uint64
+}
+
+// Change is a single difference between two compound files.
+type Change struct {
+	Kind ChangeKind
+	// Path is the entry's path in the second file, or in the first one for
+	// removed entries. OldPath is the path in the first file, for renamed
+	// entries.
+	Path    string
+	OldPath string
+	ObjType ObjectType
+	// Fields lists the properties that differ, for modified and renamed
+	// entries.
+	Fields []string
+	// Ranges lists the differing bytes of a modified stream, if requested
+	// with DiffOptions.ByteRanges.
+	Ranges []ByteRange
+}
+
+type DiffOptions struct {
+	// ByteRanges reports which bytes differ within modified streams.
+	ByteRanges bool
+}
+
+// Reports the storages and streams added, removed, renamed or modified
+// between a and b. A stream that disappears from one path while a stream
+// with the same content appears at another is reported as renamed, as is an
+// entry whose name only changed case. Changes are sorted by path.
+func Diff(a, b *CompoundFile) ([]Change, error) {
+	return DiffWithOptions(a, b, DiffOptions{})
+}
+
+func DiffWithOptions(a, b *CompoundFile, options DiffOptions) ([]Change, error) {
+	if err := a.checkOpen(); err != nil {
+		return nil, err
+	}
+	if err := b.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	entriesA, err := diffEntries(a)
+	if err != nil {
+		return nil, err
+	}
+	entriesB, err := diffEntries(b)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]Change, 0)
+	removed := make([]*diffEntry, 0)
+	added := make([]*diffEntry, 0)
+
+	for _, entryA := range entriesA.list {
+		entryB := entriesB.lookup(entryA.NameChain)
+		if entryB == nil {
+			removed = append(removed, entryA)
+			continue
+		}
+
+		// Names compare case-insensitively, so an entry whose name only
+		// changed case is the same entry, renamed.
+		fields := entryA.differingFields(entryB)
+		renamed := entryA.Path != entryB.Path
+		if len(fields) == 0 && !renamed {
+			continue
+		}
+
+		change := Change{
+			Kind:    ChangeModified,
+			Path:    entryB.Path,
+			ObjType: entryB.ObjType,
+			Fields:  fields,
+		}
+		if renamed {
+			change.Kind = ChangeRenamed
+			change.OldPath = entryA.Path
+		}
+		if options.ByteRanges && entryA.IsStream() && entryB.IsStream() && !bytes.Equal(entryA.hash, entryB.hash) {
+			change.Ranges, err = diffStreams(a, entryA, b, entryB)
+			if err != nil {
+				return nil, err
+			}
+		}
+		changes = append(changes, change)
+	}
+
+	for _, entryB := range entriesB.list {
+		if entriesA.lookup(entryB.NameChain) == nil {
+			added = append(added, entryB)
+		}
+	}
+
+	// Pair removed streams with added streams of the same content. Empty
+	// streams all look alike, so they are never paired.
+	renamedTo := make(map[*diffEntry]bool)
+	for _, entryA := range removed {
+		var match *diffEntry
+		if entryA.IsStream() && entryA.StreamLen > 0 {
+			for _, entryB := range added {
+				if !renamedTo[entryB] && entryB.IsStream() && bytes.Equal(entryA.hash, entryB.hash) {
+					match = entryB
+					break
+				}
+			}
+		}
+
+		if match == nil {
+			changes = append(changes, Change{Kind: ChangeRemoved, Path: entryA.Path, ObjType: entryA.ObjType})
+			continue
+		}
+
+		renamedTo[match] = true
+		changes = append(changes, Change{
+			Kind:    ChangeRenamed,
+			Path:    match.Path,
+			OldPath: entryA.Path,
+			ObjType: match.ObjType,
+			Fields:  entryA.differingFields(match),
+		})
+	}
+
+	for _, entryB := range added {
+		if !renamedTo[entryB] {
+			changes = append(changes, Change{Kind: ChangeAdded, Path: entryB.Path, ObjType: entryB.ObjType})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+
+	return changes, nil
+}
+
+type diffEntry struct {
+	*Entry
+	hash []byte
+}
+
+type diffEntrySet struct {
+	list []*diffEntry
+	// byParent groups the entries by the path of their parent storage, as
+	// found in the file.
+	byParent map[string][]*diffEntry
+}
+
+// Returns the entry whose name chain matches nameChain, comparing each name
+// the way the directory orders them, or nil.
+func (s *diffEntrySet) lookup(nameChain []string) *diffEntry {
+	if len(nameChain) == 0 {
+		if roots := s.byParent[""]; len(roots) > 0 {
+			return roots[0]
+		}
+		return nil
+	}
+
+	parentPath := "/"
+	if len(nameChain) > 1 {
+		parent := s.lookup(nameChain[:len(nameChain)-1])
+		if parent == nil {
+			return nil
+		}
+		parentPath = parent.Path
+	}
+
+	name := nameChain[len(nameChain)-1]
+	for _, entry := range s.byParent[parentPath] {
+		if CompareNames(entry.Name, name) == OrderEqual {
+			return entry
+		}
+	}
+
+	return nil
+}
+
+// Walks a file, hashing the content of every stream.
+func diffEntries(c *CompoundFile) (*diffEntrySet, error) {
+	set := &diffEntrySet{
+		list:     make([]*diffEntry, 0),
+		byParent: make(map[string][]*diffEntry),
+	}
+
+	entries := c.Walk()
+	for entry := entries.Next(); entry != nil; entry = entries.Next() {
+		diffEntry := &diffEntry{Entry: entry}
+		if entry.IsStream() {
+			hash := sha256.New()
+			_, err := io.Copy(hash, newStream(c, entry.StreamId))
+			if err != nil {
+				return nil, err
+			}
+			diffEntry.hash = hash.Sum(nil)
+		}
+
+		set.list = append(set.list, diffEntry)
+		parentPath := ""
+		if len(entry.NameChain) > 0 {
+			parentPath = PathFromNameChain(entry.NameChain[:len(entry.NameChain)-1])
+		}
+		set.byParent[parentPath] = append(set.byParent[parentPath], diffEntry)
+	}
+	if err := entries.Err(); err != nil {
+		return nil, err
+	}
+
+	return set, nil
+}
+
+func (e *diffEntry) differingFields(other *diffEntry) []string {
+	fields := make([]string, 0)
+	if e.ObjType != other.ObjType {
+		fields = append(fields, FieldObjType)
+	}
+	if e.CLSID != other.CLSID {
+		fields = append(fields, FieldCLSID)
+	}
+	if e.StateBits != other.StateBits {
+		fields = append(fields, FieldStateBits)
+	}
+	if e.CreationTime != other.CreationTime {
+		fields = append(fields, FieldCreationTime)
+	}
+	if e.ModifiedTime != other.ModifiedTime {
+		fields = append(fields, FieldModifiedTime)
+	}
+	if !bytes.Equal(e.hash, other.hash) {
+		fields = append(fields, FieldContent)
+	}
+
+	return fields
+}
+
+// Compares two streams chunk by chunk, returning the ranges that differ.
+func diffStreams(a *CompoundFile, entryA *diffEntry, b *CompoundFile, entryB *diffEntry) ([]ByteRange, error) {
+	streamA := newStream(a, entryA.StreamId)
+	streamB := newStream(b, entryB.StreamId)
+	bufA := make([]byte, BUFFER_SIZE)
+	bufB := make([]byte, BUFFER_SIZE)
+
+	ranges := make([]ByteRange, 0)
+	add := func(offset, length uint64) {
+		if len(ranges) > 0 {
+			last := &ranges[len(ranges)-1]
+			if last.Offset+last.Length == offset {
+				last.Length += length
+				return
+			}
+		}
+		ranges = append(ranges, ByteRange{Offset: offset, Length: length})
+	}
+
+	common := min(entryA.StreamLen, entryB.StreamLen)
+	for offset := uint64(0); offset < common; {
+		n := int(min(uint64(len(bufA)), common-offset))
+		if _, err := io.ReadFull(streamA, bufA[:n]); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(streamB, bufB[:n]); err != nil {
+			return nil, err
+		}
+
+		for i := 0; i < n; i++ {
+			if bufA[i] != bufB[i] {
+				add(offset+uint64(i), 1)
+			}
+		}
+		offset += uint64(n)
+	}
+
+	if entryA.StreamLen != entryB.StreamLen {
+		longer := entryA.StreamLen
+		if entryB.StreamLen > longer {
+			longer = entryB.StreamLen
+		}
+		add(common, longer-common)
+	}
+
+	return ranges, nil
+}
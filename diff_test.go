@@ -0,0 +1,99 @@
+package mscfb
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	modified := testPattern(3, 5000)
+	modified[10] ^= 0xff
+	modified[11] ^= 0xff
+	modified[4000] ^= 0xff
+
+	before := testFile{entries: []testEntry{
+		{path: "/same", data: testPattern(1, 100)},
+		{path: "/old name", data: testPattern(2, 700)},
+		{path: "/changed", data: testPattern(3, 5000)},
+		{path: "/grown", data: testPattern(4, 10)},
+		{path: "/gone", data: testPattern(5, 20)},
+		{path: "/storage", storage: true},
+	}}.build(t)
+	after := testFile{entries: []testEntry{
+		{path: "/same", data: testPattern(1, 100)},
+		{path: "/new name", data: testPattern(2, 700)},
+		{path: "/changed", data: modified},
+		{path: "/grown", data: testPattern(4, 15)},
+		{path: "/new", data: testPattern(6, 30)},
+		{path: "/storage", storage: true},
+	}}.build(t)
+
+	a, err := Open(bytes.NewReader(before.data), ValidationStrict)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	b, err := Open(bytes.NewReader(after.data), ValidationStrict)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	b.Directory.DirEntries[after.dirIds["/storage"]].StateBits = 7
+
+	changes, err := DiffWithOptions(a, b, DiffOptions{ByteRanges: true})
+	if err != nil {
+		t.Fatalf("DiffWithOptions() error = %v", err)
+	}
+
+	want := []Change{
+		{Kind: ChangeModified, Path: "/changed", ObjType: ObjStream, Fields: []string{FieldContent}, Ranges: []ByteRange{{Offset: 10, Length: 2}, {Offset: 4000, Length: 1}}},
+		{Kind: ChangeRemoved, Path: "/gone", ObjType: ObjStream},
+		{Kind: ChangeModified, Path: "/grown", ObjType: ObjStream, Fields: []string{FieldContent}, Ranges: []ByteRange{{Offset: 10, Length: 5}}},
+		{Kind: ChangeAdded, Path: "/new", ObjType: ObjStream},
+		{Kind: ChangeRenamed, Path: "/new name", OldPath: "/old name", ObjType: ObjStream, Fields: []string{}},
+		{Kind: ChangeModified, Path: "/storage", ObjType: ObjStorage, Fields: []string{FieldStateBits}},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("DiffWithOptions() = %+v, want %+v", changes, want)
+	}
+
+	changes, err = Diff(a, a)
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("Diff() of a file with itself = %+v, want none", changes)
+	}
+}
+
+// Names compare case-insensitively, so changing the case of a name renames
+// the entry rather than replacing it.
+func TestDiffCaseOnlyRename(t *testing.T) {
+	before := testFile{entries: []testEntry{
+		{path: "/storage/stream", data: testPattern(1, 100)},
+	}}.build(t)
+	after := testFile{entries: []testEntry{
+		{path: "/STORAGE/Stream", data: testPattern(2, 100)},
+	}}.build(t)
+
+	a, err := Open(bytes.NewReader(before.data), ValidationStrict)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	b, err := Open(bytes.NewReader(after.data), ValidationStrict)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	changes, err := Diff(a, b)
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+
+	want := []Change{
+		{Kind: ChangeRenamed, Path: "/STORAGE", OldPath: "/storage", ObjType: ObjStorage, Fields: []string{}},
+		{Kind: ChangeRenamed, Path: "/STORAGE/Stream", OldPath: "/storage/stream", ObjType: ObjStream, Fields: []string{FieldContent}},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("Diff() = %+v, want %+v", changes, want)
+	}
+}
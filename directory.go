@@ -6,13 +6,15 @@ type Directory struct {
 	Allocator      *Allocator
 	DirEntries     []*DirEntry
 	DirStartSector uint32
+	MiniSectorLen  int
 }
 
-func NewDirectory(allocator *Allocator, dirEntries []*DirEntry, dirStartSector uint32) (*Directory, error) {
+func NewDirectory(allocator *Allocator, dirEntries []*DirEntry, dirStartSector uint32, miniSectorLen int) (*Directory, error) {
 	dir := Directory{
 		Allocator:      allocator,
 		DirEntries:     dirEntries,
 		DirStartSector: dirStartSector,
+		MiniSectorLen:  miniSectorLen,
 	}
 
 	err := dir.Validate()
@@ -44,8 +46,8 @@ func (d *Directory) Validate() error {
 		return fmt.Errorf("directory has no root entry")
 	}
 
-	if rootDirEntry.StreamSize%uint64(MINI_SECTOR_LEN) != 0 {
-		return fmt.Errorf("root stream len is %v, but should be multiple of %v", rootDirEntry.StreamSize, MINI_SECTOR_LEN)
+	if rootDirEntry.StreamSize%uint64(d.MiniSectorLen) != 0 {
+		return fmt.Errorf("root stream len is %v, but should be multiple of %v", rootDirEntry.StreamSize, d.MiniSectorLen)
 	}
 
 	visited := make(map[uint32]bool)
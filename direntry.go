@@ -48,19 +48,25 @@ func NewDirEntry(name string, objType ObjectType, timestamp uint64) *DirEntry {
 }
 
 func ReadDirEntry(reader io.ReadSeeker, version Version, validation Validation) (*DirEntry, error) {
-
-	name := make([]uint16, 32)
-	err := binary.Read(reader, binary.LittleEndian, &name)
+	buf := make([]byte, DIR_ENTRY_LEN)
+	_, err := io.ReadFull(reader, buf)
 	if err != nil {
 		return nil, err
 	}
 
-	var nameLength uint16
-	err = binary.Read(reader, binary.LittleEndian, &nameLength)
-	if err != nil {
-		return nil, err
+	return DecodeDirEntry(buf, version, validation)
+}
+
+// Decodes and validates a directory entry from the first DIR_ENTRY_LEN bytes
+// of buf.
+func DecodeDirEntry(buf []byte, version Version, validation Validation) (*DirEntry, error) {
+	if len(buf) < DIR_ENTRY_LEN {
+		return nil, fmt.Errorf("directory entry needs %v bytes, found %v", DIR_ENTRY_LEN, len(buf))
 	}
 
+	raw := decodeRawDirEntry(buf)
+
+	nameLength := raw.nameLength
 	if nameLength > 64 {
 		return nil, fmt.Errorf("name length is too long: %v", nameLength)
 	}
@@ -73,21 +79,16 @@ func ReadDirEntry(reader io.ReadSeeker, version Version, validation Validation)
 		nameCharLength = (nameLength / 2) - 1
 	}
 
+	name := raw.name[:]
 	if validation.IsStrict() && name[nameCharLength] != 0 {
 		return nil, fmt.Errorf("name is not null terminated")
 	}
 
 	nameStr := string(utf16.Decode(name[:nameCharLength]))
 
-	var objTypeByte uint8
-	err = binary.Read(reader, binary.LittleEndian, &objTypeByte)
-	if err != nil {
-		return nil, err
-	}
-
-	objType := ObjectFromByte(objTypeByte)
+	objType := ObjectFromByte(raw.objType)
 	if objType == -1 {
-		return nil, fmt.Errorf("invalid object type: %v", objTypeByte)
+		return nil, fmt.Errorf("invalid object type: %v", raw.objType)
 	}
 
 	// According to section 2.6.2 of the MS-CFB spec, "The root directory
@@ -102,45 +103,27 @@ func ReadDirEntry(reader io.ReadSeeker, version Version, validation Validation)
 		}
 	}
 
-	err = ValidateName(nameStr, name)
+	err := ValidateName(nameStr, name)
 	if err != nil {
 		return nil, err
 	}
 
-	var colorByte uint8
-	err = binary.Read(reader, binary.LittleEndian, &colorByte)
-	if err != nil {
-		return nil, err
-	}
-
-	color := ColorFromByte(colorByte)
+	color := ColorFromByte(raw.color)
 	if color == -1 {
-		return nil, fmt.Errorf("invalid color: %v", colorByte)
+		return nil, fmt.Errorf("invalid color: %v", raw.color)
 	}
 
-	var leftSibling uint32
-	err = binary.Read(reader, binary.LittleEndian, &leftSibling)
-	if err != nil {
-		return nil, err
-	}
+	leftSibling := raw.leftSibling
 	if leftSibling != NO_STREAM && leftSibling > MAX_REGULAR_SECTOR {
 		return nil, fmt.Errorf("invalid left sibling: %v", leftSibling)
 	}
 
-	var rightSibling uint32
-	err = binary.Read(reader, binary.LittleEndian, &rightSibling)
-	if err != nil {
-		return nil, err
-	}
+	rightSibling := raw.rightSibling
 	if rightSibling != NO_STREAM && rightSibling > MAX_REGULAR_SECTOR {
 		return nil, fmt.Errorf("invalid left sibling: %v", rightSibling)
 	}
 
-	var child uint32
-	err = binary.Read(reader, binary.LittleEndian, &child)
-	if err != nil {
-		return nil, err
-	}
+	child := raw.child
 	if child != NO_STREAM {
 		if objType == ObjStream {
 			return nil, fmt.Errorf("non-empty stream child: %v", child)
@@ -155,7 +138,7 @@ func ReadDirEntry(reader io.ReadSeeker, version Version, validation Validation)
 	// files in the wild violate this, so under Permissive validation we
 	// don't enforce it; instead, for non-storage objects we just ignore
 	// the CLSID data entirely and treat it as though it were nil.
-	clsid, _ := readUuid(reader)
+	clsid := raw.clsid
 	if objType == ObjStream && clsid != uuid.Nil {
 		if validation.IsStrict() {
 			return nil, fmt.Errorf("non-nil CLSID for stream: %v", clsid)
@@ -163,37 +146,8 @@ func ReadDirEntry(reader io.ReadSeeker, version Version, validation Validation)
 		clsid = uuid.Nil
 	}
 
-	var stateBits uint32
-	err = binary.Read(reader, binary.LittleEndian, &stateBits)
-	if err != nil {
-		return nil, err
-	}
-
-	var creationTime uint64
-	err = binary.Read(reader, binary.LittleEndian, &creationTime)
-	if err != nil {
-		return nil, err
-	}
-
-	var modifiedTime uint64
-	err = binary.Read(reader, binary.LittleEndian, &modifiedTime)
-	if err != nil {
-		return nil, err
-	}
-
-	var startingSector uint32
-	err = binary.Read(reader, binary.LittleEndian, &startingSector)
-	if err != nil {
-		return nil, err
-	}
-
-	var streamSize uint64
-	err = binary.Read(reader, binary.LittleEndian, &streamSize)
-	if err != nil {
-		return nil, err
-	}
-
-	streamSize = streamSize & version.SectorLenMask()
+	startingSector := raw.startingSector
+	streamSize := raw.streamSize & version.SectorLenMask()
 	if objType == ObjStorage {
 		if validation.IsStrict() && startingSector != 0 {
 			return nil, fmt.Errorf("non-zero starting sector for storage: %v", startingSector)
@@ -214,9 +168,9 @@ func ReadDirEntry(reader io.ReadSeeker, version Version, validation Validation)
 		RightSibling:   rightSibling,
 		Child:          child,
 		CLSID:          clsid,
-		StateBits:      stateBits,
-		CreationTime:   creationTime,
-		ModifiedTime:   modifiedTime,
+		StateBits:      raw.stateBits,
+		CreationTime:   raw.creationTime,
+		ModifiedTime:   raw.modifiedTime,
 		StartingSector: startingSector,
 		StreamSize:     streamSize,
 	}
@@ -224,42 +178,77 @@ func ReadDirEntry(reader io.ReadSeeker, version Version, validation Validation)
 	return &dir, nil
 }
 
-func readUuid(reader io.Reader) (uuid.UUID, error) {
-	var d1 uint32
-	var d2 uint16
-	var d3 uint16
-	var d4 [8]byte
+// rawDirEntry holds the fields of a directory entry as they are stored,
+// before any validation.
+type rawDirEntry struct {
+	name           [32]uint16
+	nameLength     uint16
+	objType        uint8
+	color          uint8
+	leftSibling    uint32
+	rightSibling   uint32
+	child          uint32
+	clsid          uuid.UUID
+	stateBits      uint32
+	creationTime   uint64
+	modifiedTime   uint64
+	startingSector uint32
+	streamSize     uint64
+}
 
-	err := binary.Read(reader, binary.LittleEndian, &d1)
-	if err != nil {
-		return [16]byte{}, err
-	}
+// Decodes the fields of a directory entry from the first DIR_ENTRY_LEN
+// bytes of buf.
+func decodeRawDirEntry(buf []byte) *rawDirEntry {
+	le := binary.LittleEndian
+
+	raw := &rawDirEntry{
+		nameLength:     le.Uint16(buf[64:]),
+		objType:        buf[66],
+		color:          buf[67],
+		leftSibling:    le.Uint32(buf[68:]),
+		rightSibling:   le.Uint32(buf[72:]),
+		child:          le.Uint32(buf[76:]),
+		clsid:          decodeUuid(buf[80:96]),
+		stateBits:      le.Uint32(buf[96:]),
+		creationTime:   le.Uint64(buf[100:]),
+		modifiedTime:   le.Uint64(buf[108:]),
+		startingSector: le.Uint32(buf[116:]),
+		streamSize:     le.Uint64(buf[120:]),
+	}
+	for i := range raw.name {
+		raw.name[i] = le.Uint16(buf[i*2:])
+	}
+
+	return raw
+}
 
-	err = binary.Read(reader, binary.LittleEndian, &d2)
+func readUuid(reader io.Reader) (uuid.UUID, error) {
+	buf := make([]byte, 16)
+	_, err := io.ReadFull(reader, buf)
 	if err != nil {
 		return [16]byte{}, err
 	}
 
-	err = binary.Read(reader, binary.LittleEndian, &d3)
-	if err != nil {
-		return [16]byte{}, err
-	}
+	return decodeUuid(buf), nil
+}
 
-	err = binary.Read(reader, binary.LittleEndian, &d4)
-	if err != nil {
-		return [16]byte{}, err
-	}
+// Decodes a UUID from the first 16 bytes of buf, whose first three fields
+// are stored little-endian.
+func decodeUuid(buf []byte) uuid.UUID {
+	var id uuid.UUID
+	binary.BigEndian.PutUint32(id[0:], binary.LittleEndian.Uint32(buf[0:]))
+	binary.BigEndian.PutUint16(id[4:], binary.LittleEndian.Uint16(buf[4:]))
+	binary.BigEndian.PutUint16(id[6:], binary.LittleEndian.Uint16(buf[6:]))
+	copy(id[8:], buf[8:16])
+
+	return id
+}
 
-	uuidBytes := make([]byte, 16)
-	uuidBytes[0] = byte(d1 >> 24)
-	uuidBytes[1] = byte(d1 >> 16)
-	uuidBytes[2] = byte(d1 >> 8)
-	uuidBytes[3] = byte(d1)
-	uuidBytes[4] = byte(d2 >> 8)
-	uuidBytes[5] = byte(d2)
-	uuidBytes[6] = byte(d3 >> 8)
-	uuidBytes[7] = byte(d3)
-	copy(uuidBytes[8:], d4[:])
-
-	return uuid.FromBytes(uuidBytes)
+// Writes a UUID into the first 16 bytes of buf using the mixed-endian layout
+// read by decodeUuid.
+func writeUuid(buf []byte, id uuid.UUID) {
+	binary.LittleEndian.PutUint32(buf[0:], binary.BigEndian.Uint32(id[0:4]))
+	binary.LittleEndian.PutUint16(buf[4:], binary.BigEndian.Uint16(id[4:6]))
+	binary.LittleEndian.PutUint16(buf[6:], binary.BigEndian.Uint16(id[6:8]))
+	copy(buf[8:16], id[8:16])
 }
@@ -1,14 +1,18 @@
 package mscfb
 
 import (
-	"path"
+	"context"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 type Entry struct {
+	StreamId     uint32
 	Name         string
 	Path         string
+	NameChain    []string
 	ObjType      ObjectType
 	CLSID        uuid.UUID
 	StateBits    uint32
@@ -21,6 +25,7 @@ func NewEntry(dirEntry *DirEntry, path string) *Entry {
 	entry := Entry{
 		Name:         dirEntry.Name,
 		Path:         path,
+		NameChain:    NameChainFromPath(path),
 		ObjType:      dirEntry.ObjType,
 		CLSID:        dirEntry.CLSID,
 		StateBits:    dirEntry.StateBits,
@@ -44,6 +49,16 @@ func (e *Entry) IsRoot() bool {
 	return e.ObjType == ObjRoot
 }
 
+// Returns the creation time, or the zero time if it isn't set.
+func (e *Entry) Created() time.Time {
+	return TimeFromFiletime(e.CreationTime)
+}
+
+// Returns the modification time, or the zero time if it isn't set.
+func (e *Entry) Modified() time.Time {
+	return TimeFromFiletime(e.ModifiedTime)
+}
+
 type EntriesOrder int
 
 const (
@@ -61,6 +76,10 @@ type Entries struct {
 	Order     EntriesOrder
 	Directory *Directory
 	Stack     []*EntriesStack
+
+	// If set, the walk ends once ctx is cancelled, leaving its error in err.
+	ctx context.Context
+	err error
 }
 
 func NewEntries(order EntriesOrder, directory *Directory, parentPath string, start uint32) *Entries {
@@ -102,6 +121,14 @@ func (e *Entries) Next() *Entry {
 		return nil
 	}
 
+	if e.ctx != nil {
+		if err := e.ctx.Err(); err != nil {
+			e.err = err
+			e.Stack = e.Stack[:0]
+			return nil
+		}
+	}
+
 	//pop stack
 	currentStack := e.Stack[len(e.Stack)-1]
 	e.Stack = e.Stack[:len(e.Stack)-1]
@@ -113,12 +140,20 @@ func (e *Entries) Next() *Entry {
 	}
 
 	if e.Order == EntriesPreorder &&
-		dirEntry.ObjType == ObjStream &&
+		dirEntry.ObjType != ObjStream &&
 		dirEntry.Child != NO_STREAM {
 		e.StackLeftSpine(path, dirEntry.Child)
 	}
 
-	return NewEntry(dirEntry, path)
+	entry := NewEntry(dirEntry, path)
+	entry.StreamId = currentStack.StreamId
+
+	return entry
+}
+
+// Returns the error that ended the walk early, if any.
+func (e *Entries) Err() error {
+	return e.err
 }
 
 func joinPath(parentPath string, dirEntry *DirEntry) string {
@@ -126,5 +161,9 @@ func joinPath(parentPath string, dirEntry *DirEntry) string {
 		return parentPath
 	}
 
-	return path.Join(parentPath, dirEntry.Name)
+	if strings.HasSuffix(parentPath, "/") {
+		return parentPath + EscapeName(dirEntry.Name)
+	}
+
+	return parentPath + "/" + EscapeName(dirEntry.Name)
 }
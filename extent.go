@@ -0,0 +1,106 @@
+package mscfb
+
+import "fmt"
+
+// Extent maps a run of a stream's bytes to the place in the file where they
+// are stored.
+type Extent struct {
+	StreamOffset uint64
+	FileOffset   int64
+	Length       uint64
+}
+
+// Returns the runs of file bytes holding the stream's data, in stream order.
+// Streams below the mini stream cutoff are resolved through the mini stream
+// to the sectors holding it. Physically adjacent runs are merged.
+func (s *Stream) PhysicalExtents() ([]*Extent, error) {
+	if err := s.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	return s.CompoundFile.streamExtents(s.StreamId)
+}
+
+// Returns the physical extents of the stream at path; see
+// Stream.PhysicalExtents.
+func (c *CompoundFile) Extents(path string) ([]*Extent, error) {
+	stream, err := c.OpenStream(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return stream.PhysicalExtents()
+}
+
+func (c *CompoundFile) streamExtents(streamId uint32) ([]*Extent, error) {
+	dirEntry := c.Directory.DirEntries[streamId]
+	extents := make([]*Extent, 0)
+	if dirEntry.StreamSize == 0 {
+		return extents, nil
+	}
+
+	sectorLen := uint64(c.Directory.Allocator.Sectors.SectorLen())
+	add := func(streamOffset uint64, fileOffset int64, length uint64) {
+		if len(extents) > 0 {
+			last := extents[len(extents)-1]
+			if last.FileOffset+int64(last.Length) == fileOffset {
+				last.Length += length
+				return
+			}
+		}
+		extents = append(extents, &Extent{
+			StreamOffset: streamOffset,
+			FileOffset:   fileOffset,
+			Length:       length,
+		})
+	}
+
+	if c.isMiniStream(dirEntry) {
+		miniChain, err := c.MiniAlloc.OpenMiniChain(dirEntry.StartingSector)
+		if err != nil {
+			return nil, err
+		}
+		rootChain, err := c.MiniAlloc.miniStreamChain()
+		if err != nil {
+			return nil, err
+		}
+
+		miniSectorLen := uint64(c.MiniAlloc.MiniSectorLen)
+		for i, miniSectorId := range miniChain.SectorIds {
+			streamOffset := uint64(i) * miniSectorLen
+			if streamOffset >= dirEntry.StreamSize {
+				break
+			}
+
+			miniStreamOffset := uint64(miniSectorId) * miniSectorLen
+			index := miniStreamOffset / sectorLen
+			if index >= uint64(len(rootChain.SectorIds)) {
+				return nil, fmt.Errorf("mini sector %v is past the end of the mini stream", miniSectorId)
+			}
+
+			fileOffset := sectorFileOffset(rootChain.SectorIds[index], sectorLen) + int64(miniStreamOffset%sectorLen)
+			add(streamOffset, fileOffset, min(miniSectorLen, dirEntry.StreamSize-streamOffset))
+		}
+	} else {
+		chain, err := c.Directory.Allocator.OpenChain(dirEntry.StartingSector, SectorInitZero)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, sectorId := range chain.SectorIds {
+			streamOffset := uint64(i) * sectorLen
+			if streamOffset >= dirEntry.StreamSize {
+				break
+			}
+
+			add(streamOffset, sectorFileOffset(sectorId, sectorLen), min(sectorLen, dirEntry.StreamSize-streamOffset))
+		}
+	}
+
+	return extents, nil
+}
+
+// Returns the offset in the file of the first byte of a sector.
+func sectorFileOffset(sectorId uint32, sectorLen uint64) int64 {
+	return int64(uint64(sectorId)+1) * int64(sectorLen)
+}
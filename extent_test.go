@@ -0,0 +1,45 @@
+package mscfb
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPhysicalExtents(t *testing.T) {
+	entries := []testEntry{
+		{path: "/empty", data: []byte{}},
+		{path: "/small", data: testPattern(1, 100)},
+		{path: "/storage/large", data: testPattern(2, 5000)},
+	}
+
+	for _, version := range []Version{V3, V4} {
+		img := testFile{version: version, entries: entries}.build(t)
+		cf, err := Open(bytes.NewReader(img.data), ValidationStrict)
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+
+		for _, e := range entries {
+			extents, err := cf.Extents(e.path)
+			if err != nil {
+				t.Fatalf("Extents(%v) error = %v", e.path, err)
+			}
+
+			// Contiguously allocated streams collapse to a single extent.
+			if len(e.data) > 0 && len(extents) != 1 {
+				t.Errorf("v%v %v: got %v extents, want 1", version, e.path, len(extents))
+			}
+
+			got := make([]byte, 0, len(e.data))
+			for _, extent := range extents {
+				if extent.StreamOffset != uint64(len(got)) {
+					t.Errorf("v%v %v: extent at stream offset %v, want %v", version, e.path, extent.StreamOffset, len(got))
+				}
+				got = append(got, img.data[extent.FileOffset:extent.FileOffset+int64(extent.Length)]...)
+			}
+			if !bytes.Equal(got, e.data) {
+				t.Errorf("v%v %v: extents cover %v bytes not matching the stream", version, e.path, len(got))
+			}
+		}
+	}
+}
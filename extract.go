@@ -0,0 +1,273 @@
+package mscfb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type ExtractOptions struct {
+	// Workers is the number of streams written at once; runtime.NumCPU()
+	// if not set.
+	Workers int
+	// Overwrite replaces existing files; otherwise streams whose file
+	// already exists fail with an ExtractError.
+	Overwrite bool
+}
+
+// ExtractError is a failure to extract a single storage or stream.
+type ExtractError struct {
+	Path string
+	Err  error
+}
+
+func (e *ExtractError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Path, e.Err)
+}
+
+func (e *ExtractError) Unwrap() error {
+	return e.Err
+}
+
+// ExtractResult summarizes an extraction.
+type ExtractResult struct {
+	Storages int
+	Streams  int
+	Bytes    int64
+	// Errors lists the storages and streams that couldn't be extracted,
+	// sorted by path.
+	Errors []*ExtractError
+}
+
+type extractJob struct {
+	entry    *Entry
+	filePath string
+}
+
+// Writes the contents of a compound file below dir: storages become
+// directories and streams become files, named after the entries with
+// characters and names that aren't safe in file names escaped. Streams are
+// written by a bounded pool of workers, and modification times are carried
+// over where the file records them. A storage or stream that fails doesn't
+// stop the others; the failures are collected in the result. The error is
+// only set if dir itself can't be created or cf is closed.
+func ExtractAll(cf *CompoundFile, dir string, options ExtractOptions) (*ExtractResult, error) {
+	return ExtractAllContext(context.Background(), cf, dir, options)
+}
+
+// Like ExtractAll, but stops once ctx is cancelled, returning what was
+// extracted so far along with ctx's error. The stream being written at the
+// time is left partially written.
+func ExtractAllContext(ctx context.Context, cf *CompoundFile, dir string, options ExtractOptions) (*ExtractResult, error) {
+	err := cf.checkOpen()
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ExtractResult{Errors: make([]*ExtractError, 0)}
+	defer func() {
+		sort.SliceStable(result.Errors, func(i, j int) bool {
+			return result.Errors[i].Path < result.Errors[j].Path
+		})
+	}()
+	storages := make([]extractJob, 0)
+	streams := make([]extractJob, 0)
+	failed := make(map[string]bool)
+
+	entries := cf.WalkContext(ctx)
+	for entry := entries.Next(); entry != nil; entry = entries.Next() {
+		if failed[parentPath(entry.Path)] {
+			failed[entry.Path] = true
+			continue
+		}
+
+		job := extractJob{entry: entry, filePath: extractPath(dir, entry.NameChain)}
+		if entry.IsStream() {
+			streams = append(streams, job)
+			continue
+		}
+
+		if !entry.IsRoot() {
+			err := os.Mkdir(job.filePath, 0o755)
+			if err != nil && !(os.IsExist(err) && isDir(job.filePath)) {
+				result.Errors = append(result.Errors, &ExtractError{Path: entry.Path, Err: err})
+				failed[entry.Path] = true
+				continue
+			}
+			result.Storages++
+		}
+		storages = append(storages, job)
+	}
+	if err := entries.Err(); err != nil {
+		return result, err
+	}
+
+	workers := options.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	jobs := make(chan extractJob)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				n, err := extractStream(ctx, cf, job, options)
+				if ctx.Err() != nil {
+					continue
+				}
+
+				mu.Lock()
+				if err != nil {
+					result.Errors = append(result.Errors, &ExtractError{Path: job.entry.Path, Err: err})
+				} else {
+					result.Streams++
+					result.Bytes += n
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for _, job := range streams {
+		select {
+		case jobs <- job:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+
+	// Writing files changes the times of the directories holding them, so
+	// the storages' times are set last, innermost first.
+	for i := len(storages) - 1; i >= 0; i-- {
+		err := setModifiedTime(storages[i].filePath, storages[i].entry)
+		if err != nil {
+			result.Errors = append(result.Errors, &ExtractError{Path: storages[i].entry.Path, Err: err})
+		}
+	}
+
+	return result, nil
+}
+
+func extractStream(ctx context.Context, cf *CompoundFile, job extractJob, options ExtractOptions) (int64, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !options.Overwrite {
+		flags |= os.O_EXCL
+	}
+
+	file, err := os.OpenFile(job.filePath, flags, 0o644)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := newStream(cf, job.entry.StreamId).WriteToContext(ctx, file)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, err
+	}
+
+	return n, setModifiedTime(job.filePath, job.entry)
+}
+
+// Sets a file's access and modification times to the entry's modification
+// time, if it has one.
+func setModifiedTime(path string, entry *Entry) error {
+	modified := entry.Modified()
+	if modified.IsZero() {
+		return nil
+	}
+
+	return os.Chtimes(path, modified, modified)
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// Returns the path of an entry within dir.
+func extractPath(dir string, names []string) string {
+	elems := make([]string, 0, len(names)+1)
+	elems = append(elems, dir)
+	for _, name := range names {
+		elems = append(elems, SanitizeFileName(name))
+	}
+
+	return filepath.Join(elems...)
+}
+
+// Returns the path of an entry's parent storage.
+func parentPath(path string) string {
+	i := strings.LastIndex(path, "/")
+	if i <= 0 {
+		return "/"
+	}
+
+	return path[:i]
+}
+
+// Characters that Windows doesn't allow in file names, on top of the ones
+// EscapeName escapes.
+const unsafeFileNameChars = `<>:"\|?*`
+
+// Turns an entry name into a file name that is safe on common file
+// systems. On top of EscapeName's escaping, the characters Windows forbids,
+// a trailing dot and the reserved device names (CON, NUL, COM1, ...) are
+// percent-encoded, so different entry names never map to the same file.
+func SanitizeFileName(name string) string {
+	escaped := EscapeName(name)
+
+	var b strings.Builder
+	for i, r := range escaped {
+		if strings.ContainsRune(unsafeFileNameChars, r) ||
+			(r == '.' && i == len(escaped)-1) ||
+			(i == 0 && isReservedFileName(escaped)) {
+			fmt.Fprintf(&b, "%%%02X", r)
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// Reports whether a name is reserved for a device on Windows, with or
+// without an extension.
+func isReservedFileName(name string) bool {
+	base := strings.ToUpper(name)
+	if i := strings.IndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+	base = strings.TrimRight(base, " ")
+
+	switch base {
+	case "CON", "PRN", "AUX", "NUL":
+		return true
+	}
+	if len(base) == 4 && (strings.HasPrefix(base, "COM") || strings.HasPrefix(base, "LPT")) {
+		return base[3] >= '1' && base[3] <= '9'
+	}
+
+	return false
+}
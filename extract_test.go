@@ -0,0 +1,94 @@
+package mscfb
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExtractAll(t *testing.T) {
+	entries := []testEntry{
+		{path: "/small", data: testPattern(1, 100)},
+		{path: "/con", data: testPattern(2, 10)},
+		{path: "/storage", storage: true},
+		{path: "/storage/a?b*", data: testPattern(3, 5000)},
+		{path: "/storage/inner", storage: true},
+		{path: "/storage/inner/\x05Summary", data: testPattern(4, 3000)},
+	}
+	img := testFile{entries: entries}.build(t)
+	cf, err := Open(bytes.NewReader(img.data), ValidationStrict)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	modified := time.Date(2020, 5, 17, 12, 30, 0, 0, time.UTC)
+	cf.Directory.DirEntries[img.dirIds["/storage"]].ModifiedTime = FiletimeFromTime(modified)
+
+	dir := t.TempDir()
+	result, err := ExtractAll(cf, dir, ExtractOptions{Workers: 2})
+	if err != nil {
+		t.Fatalf("ExtractAll() error = %v", err)
+	}
+	if len(result.Errors) != 0 {
+		t.Fatalf("ExtractAll() errors = %v", result.Errors)
+	}
+	if result.Storages != 2 || result.Streams != 4 || result.Bytes != 8110 {
+		t.Errorf("ExtractAll() = %+v, want 2 storages, 4 streams and 8110 bytes", result)
+	}
+
+	files := map[string][]byte{
+		"small":                    entries[0].data,
+		"%63on":                    entries[1].data,
+		"storage/a%3Fb%2A":         entries[3].data,
+		"storage/inner/%05Summary": entries[5].data,
+	}
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("ReadFile(%v) error = %v", name, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%v: extracted %v bytes not matching the stream", name, len(got))
+		}
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "storage"))
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if !info.ModTime().Equal(modified) {
+		t.Errorf("storage modified time = %v, want %v", info.ModTime(), modified)
+	}
+
+	// Without Overwrite, existing files are reported and the rest skipped.
+	result, err = ExtractAll(cf, dir, ExtractOptions{})
+	if err != nil {
+		t.Fatalf("ExtractAll() error = %v", err)
+	}
+	if len(result.Errors) != 4 || result.Errors[0].Path != "/con" || !os.IsExist(result.Errors[0].Err) {
+		t.Errorf("ExtractAll() again errors = %v, want 4 existing files", result.Errors)
+	}
+}
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := map[string]string{
+		"plain":    "plain",
+		"a/b":      "a%2Fb",
+		"\x01Ole":  "%01Ole",
+		`<>:"\|?*`: "%3C%3E%3A%22%5C%7C%3F%2A",
+		"name.":    "name%2E",
+		"..":       "%2E%2E",
+		"NUL":      "%4EUL",
+		"com1.txt": "%63om1.txt",
+		"Lpt9":     "%4Cpt9",
+		"console":  "console",
+		"COM0":     "COM0",
+	}
+	for name, want := range tests {
+		if got := SanitizeFileName(name); got != want {
+			t.Errorf("SanitizeFileName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package mscfb
+
+import (
+	"fmt"
+	"sync"
+)
+
+// DEFAULT_FAT_CACHE_SECTORS is the number of decoded FAT sectors kept when
+// the FAT is loaded lazily and OpenOptions.FatCacheSectors isn't set.
+const DEFAULT_FAT_CACHE_SECTORS = 64
+
+// allocTable is a FAT or MiniFAT, either held in memory in full or decoded
+// on demand.
+type allocTable interface {
+	Len() uint32
+	Entry(index uint32) (uint32, error)
+}
+
+// sliceTable is an allocation table held in memory in full.
+type sliceTable []uint32
+
+func (t sliceTable) Len() uint32 {
+	return uint32(len(t))
+}
+
+func (t sliceTable) Entry(index uint32) (uint32, error) {
+	if index >= uint32(len(t)) {
+		return 0, fmt.Errorf("index %v is past the %v-entry allocation table", index, len(t))
+	}
+
+	return t[index], nil
+}
+
+// lazyFat reads and decodes FAT sectors as their entries are looked up,
+// keeping the most recently used ones, so that memory use doesn't grow with
+// the size of the file.
+type lazyFat struct {
+	sectors          *Sectors
+	difat            []uint32
+	entriesPerSector uint32
+	recover          bool
+	// mu guards cache and buf.
+	mu    sync.Mutex
+	cache *lru
+	buf   []byte
+}
+
+func newLazyFat(sectors *Sectors, difat []uint32, cacheSectors int, recover bool) *lazyFat {
+	if cacheSectors <= 0 {
+		cacheSectors = DEFAULT_FAT_CACHE_SECTORS
+	}
+
+	return &lazyFat{
+		sectors:          sectors,
+		difat:            difat,
+		entriesPerSector: uint32(sectors.SectorLen() / 4),
+		recover:          recover,
+		cache:            newLRU(int64(cacheSectors)),
+		buf:              make([]byte, sectors.SectorLen()),
+	}
+}
+
+func (f *lazyFat) Len() uint32 {
+	return uint32(len(f.difat)) * f.entriesPerSector
+}
+
+func (f *lazyFat) Entry(index uint32) (uint32, error) {
+	if index >= f.Len() {
+		return 0, fmt.Errorf("index %v is past the %v-entry FAT", index, f.Len())
+	}
+
+	entries, err := f.fatSector(index / f.entriesPerSector)
+	if err != nil {
+		return 0, err
+	}
+
+	return entries[index%f.entriesPerSector], nil
+}
+
+// Returns the decoded entries of the i-th FAT sector. When recovering, the
+// entries of a FAT sector missing from the file read as END_OF_CHAIN, as
+// they do when the whole FAT is loaded.
+func (f *lazyFat) fatSector(i uint32) ([]uint32, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if entries, ok := f.cache.get(uint64(i)); ok {
+		return entries.([]uint32), nil
+	}
+
+	entries := make([]uint32, 0, f.entriesPerSector)
+	sectorId := f.difat[i]
+	if sectorId < f.sectors.NumSectors {
+		n, err := f.sectors.readSector(sectorId, f.buf)
+		if err != nil && !(err == ErrTruncated && f.recover) {
+			return nil, err
+		}
+		entries = appendUint32s(entries, f.buf[:n])
+	} else if !f.recover {
+		return nil, fmt.Errorf("invalid FAT sector index %v: %w", sectorId, ErrorInvalidCFB)
+	}
+	entries = appendMissingFatEntries(entries, int(f.entriesPerSector)-len(entries))
+
+	f.cache.add(uint64(i), entries, 1)
+	return entries, nil
+}
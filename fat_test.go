@@ -0,0 +1,145 @@
+package mscfb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOpenLazyFat(t *testing.T) {
+	entries := []testEntry{
+		{path: "/small", data: testPattern(1, 100)},
+		{path: "/large", data: testPattern(2, 300000)},
+		{path: "/storage/other", data: testPattern(3, 70000)},
+	}
+	img := testFile{entries: entries}.build(t)
+
+	eager, err := Open(bytes.NewReader(img.data), ValidationStrict)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	lazy, err := OpenWithOptions(bytes.NewReader(img.data), OpenOptions{
+		Validation:      ValidationStrict,
+		LazyFat:         true,
+		FatCacheSectors: 2,
+	})
+	if err != nil {
+		t.Fatalf("OpenWithOptions() error = %v", err)
+	}
+
+	if lazy.Directory.Allocator.Fat != nil {
+		t.Errorf("lazily opened file has its whole FAT loaded")
+	}
+	if len(eager.Directory.Allocator.Difat) <= 2 {
+		t.Fatalf("file has only %v FAT sectors, want more than the cache holds", len(eager.Directory.Allocator.Difat))
+	}
+
+	for _, e := range entries {
+		stream, err := lazy.OpenStream(e.path)
+		if err != nil {
+			t.Fatalf("OpenStream(%v) error = %v", e.path, err)
+		}
+		got, err := io.ReadAll(stream)
+		if err != nil {
+			t.Fatalf("ReadAll(%v) error = %v", e.path, err)
+		}
+		if !bytes.Equal(got, e.data) {
+			t.Errorf("%v: read %v bytes not matching the stream", e.path, len(got))
+		}
+	}
+
+	if got := lazy.Directory.Allocator.lazyFat.cache.len(); got > 2 {
+		t.Errorf("cache holds %v FAT sectors, want at most 2", got)
+	}
+
+	roles := func(cf *CompoundFile) []SectorRole {
+		sectorMap, err := cf.SectorMap()
+		if err != nil {
+			t.Fatalf("SectorMap() error = %v", err)
+		}
+		roles := make([]SectorRole, 0)
+		for _, entry := range sectorMap {
+			roles = append(roles, entry.Role)
+		}
+		return roles
+	}
+	if got, want := roles(lazy), roles(eager); !reflect.DeepEqual(got, want) {
+		t.Errorf("SectorMap() roles differ when the FAT is loaded lazily")
+	}
+}
+
+func TestLRU(t *testing.T) {
+	cache := newLRU(3)
+	cache.add(1, "a", 1)
+	cache.add(2, "b", 2)
+	cache.get(1)
+	cache.add(3, "c", 1)
+
+	if _, ok := cache.get(2); ok {
+		t.Errorf("get(2) found the least recently used value")
+	}
+	for _, key := range []uint64{1, 3} {
+		if _, ok := cache.get(key); !ok {
+			t.Errorf("get(%v) didn't find the value", key)
+		}
+	}
+
+	cache.add(4, "d", 4)
+	if _, ok := cache.get(4); ok || cache.len() != 2 {
+		t.Errorf("a value larger than the capacity was kept")
+	}
+}
+
+// A lazily loaded FAT isn't validated up front, so chains have to catch
+// cycles themselves, including ones that don't lead back to the start.
+func TestOpenLazyFatCycle(t *testing.T) {
+	img := testFile{version: V3, entries: []testEntry{
+		{path: "/large", data: testPattern(1, 5000)},
+	}}.build(t)
+	cf, err := Open(bytes.NewReader(img.data), ValidationStrict)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	start := cf.Directory.DirEntries[img.dirIds["/large"]].StartingSector
+
+	// The stream's chain runs through 10 sectors from start. Validating the
+	// whole FAT catches cycles that give a sector two predecessors.
+	tests := []struct {
+		name         string
+		from, to     uint32
+		failsEagerly bool
+	}{
+		{"back to the start", start + 9, start, false},
+		{"back to the middle", start + 7, start + 3, true},
+		{"onto itself", start + 5, start + 5, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := append([]byte(nil), img.data...)
+			binary.LittleEndian.PutUint32(data[img.sectorOffset(img.fatStart)+4*int(tt.from):], tt.to)
+
+			if _, err := Open(bytes.NewReader(data), ValidationStrict); tt.failsEagerly && err == nil {
+				t.Errorf("Open() of a cyclic FAT succeeded")
+			}
+
+			// Opening the file loads a lazy FAT without validating it, so
+			// the cycle must be caught when the chain is followed.
+			lazy, err := OpenWithOptions(bytes.NewReader(data), OpenOptions{Validation: ValidationStrict, LazyFat: true})
+			if err != nil {
+				t.Fatalf("OpenWithOptions() error = %v", err)
+			}
+			stream, err := lazy.OpenStream("/large")
+			if err != nil {
+				t.Fatalf("OpenStream() error = %v", err)
+			}
+			_, err = io.ReadAll(stream)
+			if err == nil || !strings.Contains(err.Error(), "duplicate sector id") {
+				t.Errorf("ReadAll() of a cyclic chain error = %v, want a duplicate sector", err)
+			}
+		})
+	}
+}
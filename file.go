@@ -0,0 +1,159 @@
+package mscfb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Opens the compound file at path. On Linux the file is mapped into memory,
+// so sectors are read without system calls or copies and Stream.Next can
+// hand out slices of the mapping; elsewhere it is read through an *os.File.
+// Close releases the mapping or file.
+//
+// The file must not be truncated while it is open: touching mapped pages
+// past the new end of the file raises SIGBUS and crashes the program. Open
+// the file with os.Open and pass it to OpenWithOptions instead if it may
+// change underneath.
+func OpenFile(path string, options OpenOptions) (*CompoundFile, error) {
+	return OpenFileContext(context.Background(), path, options)
+}
+
+// Like OpenFile, but gives up with ctx's error if ctx is cancelled while
+// the allocation tables and directory are read.
+func OpenFileContext(ctx context.Context, path string, options OpenOptions) (*CompoundFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return openFile(ctx, file, options)
+}
+
+// Opens a compound file from file, which is closed if that fails and
+// otherwise when the compound file is.
+func openFile(ctx context.Context, file *os.File, options OpenOptions) (*CompoundFile, error) {
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if info.Size() > 0 {
+		data, unmap, err := mapFile(file, info.Size())
+		if err == nil {
+			// The mapping outlives the file descriptor.
+			file.Close()
+
+			cf, err := openCompoundFile(ctx, bytes.NewReader(data), data, options)
+			if err != nil {
+				unmap()
+				return nil, err
+			}
+			cf.closer = unmap
+			return cf, nil
+		}
+	}
+
+	cf, err := OpenContext(ctx, file, options)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	cf.closer = file.Close
+
+	return cf, nil
+}
+
+// Returns up to n bytes from the current position and advances past them,
+// or io.EOF at the end of the stream. If the file is memory mapped, the
+// bytes aren't copied: the slice aliases the mapping, ends at the end of
+// the sector (or mini sector) holding the position, and must not be
+// modified or used after the file is closed. Otherwise the bytes are read
+// into a new slice.
+func (s *Stream) Next(n int) ([]byte, error) {
+	if err := s.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	pos := s.CurrentPosition()
+	if pos >= s.TotalLen {
+		return nil, io.EOF
+	}
+	length := min(uint64(n), s.TotalLen-pos)
+
+	data := s.CompoundFile.Directory.Allocator.Sectors.data
+	if data == nil {
+		buf := make([]byte, length)
+		read, err := io.ReadFull(s, buf)
+		return buf[:read], err
+	}
+
+	fileOffset, runLen, err := s.physicalRun(pos)
+	if err != nil {
+		return nil, err
+	}
+
+	length = min(length, runLen)
+	if fileOffset+int64(length) > int64(len(data)) {
+		if fileOffset >= int64(len(data)) {
+			return nil, s.shortChainError(pos)
+		}
+		length = uint64(int64(len(data)) - fileOffset)
+	}
+
+	_, err = s.Seek(int64(pos+length), io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	return data[fileOffset : fileOffset+int64(length)], nil
+}
+
+// Returns the file offset of the stream's byte at pos, and how many bytes
+// follow it in the same sector or mini sector.
+func (s *Stream) physicalRun(pos uint64) (int64, uint64, error) {
+	chain, err := s.streamChain()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	c := s.CompoundFile
+	sectorLen := uint64(c.Directory.Allocator.Sectors.SectorLen())
+	switch chain := chain.(type) {
+	case *Chain:
+		index := pos / sectorLen
+		if index >= uint64(len(chain.SectorIds)) {
+			return 0, 0, s.shortChainError(chain.Len())
+		}
+
+		fileOffset := sectorFileOffset(chain.SectorIds[index], sectorLen) + int64(pos%sectorLen)
+		return fileOffset, sectorLen - pos%sectorLen, nil
+
+	case *MiniChain:
+		miniSectorLen := uint64(c.MiniAlloc.MiniSectorLen)
+		index := pos / miniSectorLen
+		if index >= uint64(len(chain.SectorIds)) {
+			return 0, 0, s.shortChainError(chain.Len())
+		}
+
+		rootChain, err := c.MiniAlloc.miniStreamChain()
+		if err != nil {
+			return 0, 0, err
+		}
+
+		miniStreamOffset := uint64(chain.SectorIds[index])*miniSectorLen + pos%miniSectorLen
+		rootIndex := miniStreamOffset / sectorLen
+		if rootIndex >= uint64(len(rootChain.SectorIds)) {
+			return 0, 0, fmt.Errorf("mini sector %v is past the end of the mini stream", chain.SectorIds[index])
+		}
+
+		fileOffset := sectorFileOffset(rootChain.SectorIds[rootIndex], sectorLen) + int64(miniStreamOffset%sectorLen)
+		return fileOffset, miniSectorLen - pos%miniSectorLen, nil
+
+	default:
+		return 0, 0, fmt.Errorf("unexpected chain type %T", chain)
+	}
+}
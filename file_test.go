@@ -0,0 +1,70 @@
+package mscfb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestOpenFile(t *testing.T) {
+	entries := []testEntry{
+		{path: "/small", data: testPattern(1, 100)},
+		{path: "/storage/large", data: testPattern(2, 5000)},
+	}
+	img := testFile{entries: entries}.build(t)
+	path := filepath.Join(t.TempDir(), "test.cfb")
+	if err := os.WriteFile(path, img.data, 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	cf, err := OpenFile(path, OpenOptions{Validation: ValidationStrict})
+	if err != nil {
+		t.Fatalf("OpenFile() error = %v", err)
+	}
+	mapped := cf.Directory.Allocator.Sectors.data != nil
+	if runtime.GOOS == "linux" && !mapped {
+		t.Errorf("OpenFile() didn't map the file")
+	}
+
+	for _, e := range entries {
+		stream, err := cf.OpenStream(e.path)
+		if err != nil {
+			t.Fatalf("OpenStream(%v) error = %v", e.path, err)
+		}
+
+		got := make([]byte, 0, len(e.data))
+		for {
+			chunk, err := stream.Next(1000)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Next() error = %v", err)
+			}
+			// Mapped slices end at the end of a (mini) sector.
+			if mapped && len(chunk) > img.sectorLen {
+				t.Errorf("%v: Next() returned %v bytes, more than a sector", e.path, len(chunk))
+			}
+			got = append(got, chunk...)
+		}
+		if !bytes.Equal(got, e.data) {
+			t.Errorf("%v: Next() returned %v bytes not matching the stream", e.path, len(got))
+		}
+	}
+
+	stream, err := cf.OpenStream("/storage/large")
+	if err != nil {
+		t.Fatalf("OpenStream() error = %v", err)
+	}
+	if err := cf.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := io.ReadAll(stream); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("ReadAll() after Close() error = %v, want %v", err, fs.ErrClosed)
+	}
+}
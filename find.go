@@ -0,0 +1,163 @@
+package mscfb
+
+import (
+	"bytes"
+	"io"
+)
+
+// Size of the chunks read while scanning for embedded compound files.
+const findChunkLen = 1 << 20
+
+// EmbeddedFile is a compound file found within a larger file.
+type EmbeddedFile struct {
+	// Offset of the compound file's header in the scanned file.
+	Offset int64
+	// Length is the extent of the compound file, up to the end of the last
+	// sector its FAT allocates, clipped to the end of the scanned file.
+	Length int64
+	// Aligned is set if the offset is a multiple of 512 bytes, as it is for
+	// files carved from disk images.
+	Aligned      bool
+	CompoundFile *CompoundFile
+}
+
+type FindOptions struct {
+	// AlignedOnly only considers offsets that are a multiple of 512 bytes.
+	AlignedOnly bool
+	// Options used to open the files found. Validation is permissive
+	// by default.
+	OpenOptions OpenOptions
+}
+
+// Scans r for compound files, e.g. in a disk image, memory dump or a
+// container format that doesn't index its contents.
+func FindEmbedded(r io.ReaderAt, size int64) ([]*EmbeddedFile, error) {
+	return FindEmbeddedWithOptions(r, size, FindOptions{})
+}
+
+// Scans r for the compound file signature at every offset. Each candidate's
+// header is checked first; it is then opened over an io.SectionReader
+// bounded by the sectors its FAT can allocate, and only kept if its
+// allocation tables can be read. Its length is worked out from its FAT.
+func FindEmbeddedWithOptions(r io.ReaderAt, size int64, options FindOptions) ([]*EmbeddedFile, error) {
+	found := make([]*EmbeddedFile, 0)
+	offsets, err := findSignatures(r, size, options.AlignedOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, offset := range offsets {
+		embedded := openEmbeddedAt(r, offset, size-offset, options.OpenOptions)
+		if embedded != nil {
+			found = append(found, embedded)
+		}
+	}
+
+	return found, nil
+}
+
+// Returns the offsets of every occurrence of MAGIC_NUMBER in r.
+func findSignatures(r io.ReaderAt, size int64, alignedOnly bool) ([]int64, error) {
+	offsets := make([]int64, 0)
+	overlap := int64(len(MAGIC_NUMBER) - 1)
+	buf := make([]byte, findChunkLen+overlap)
+
+	for start := int64(0); start < size; start += findChunkLen {
+		n := int64(len(buf))
+		if start+n > size {
+			n = size - start
+		}
+
+		read, err := r.ReadAt(buf[:n], start)
+		if err != nil && !(err == io.EOF && int64(read) == n) {
+			return nil, err
+		}
+
+		chunk := buf[:n]
+		for i := 0; ; {
+			index := bytes.Index(chunk[i:], MAGIC_NUMBER)
+			if index < 0 {
+				break
+			}
+			offset := start + int64(i+index)
+			i += index + 1
+
+			// Matches in the overlap are found again by the next chunk.
+			if offset >= start+findChunkLen {
+				break
+			}
+			if alignedOnly && offset%int64(HEADER_LEN) != 0 {
+				continue
+			}
+			offsets = append(offsets, offset)
+		}
+	}
+
+	return offsets, nil
+}
+
+// Opens the compound file at offset, returning nil if it doesn't check out.
+func openEmbeddedAt(r io.ReaderAt, offset, maxLen int64, options OpenOptions) *EmbeddedFile {
+	if maxLen < int64(HEADER_LEN) {
+		return nil
+	}
+
+	// Most signature hits in arbitrary data are false positives, so check
+	// the header on its own before opening the whole file.
+	validation := options.Validation
+	if options.Recover {
+		validation = ValidationPermissive
+	}
+	header := &Header{}
+	err := header.readFrom(io.NewSectionReader(r, offset, int64(HEADER_LEN)), validation)
+	if err != nil {
+		return nil
+	}
+
+	// The file can't extend past the last sector its FAT sectors can
+	// allocate, so don't let it see the rest of the scanned file.
+	sectorLen := int64(header.SectorLen())
+	if maxSectors := int64(header.NumFatSectors) * (sectorLen / 4); (maxSectors+1)*sectorLen < maxLen {
+		maxLen = (maxSectors + 1) * sectorLen
+	}
+
+	cf, err := OpenWithOptions(io.NewSectionReader(r, offset, maxLen), options)
+	if err != nil {
+		return nil
+	}
+
+	// The section runs to the end of the scanned file, so reopen the
+	// compound file over just the sectors its FAT allocates.
+	length := embeddedLen(cf, maxLen)
+	if length < maxLen {
+		cf, err = OpenWithOptions(io.NewSectionReader(r, offset, length), options)
+		if err != nil {
+			return nil
+		}
+	}
+
+	return &EmbeddedFile{
+		Offset:       offset,
+		Length:       length,
+		Aligned:      offset%int64(HEADER_LEN) == 0,
+		CompoundFile: cf,
+	}
+}
+
+// Returns the length of a compound file up to the end of the last sector
+// its FAT allocates.
+func embeddedLen(cf *CompoundFile, maxLen int64) int64 {
+	allocator := cf.Directory.Allocator
+	last := int64(allocator.FatLen()) - 1
+	for last >= 0 && isFreeSector(allocator, uint32(last)) {
+		last--
+	}
+
+	sectorLen := int64(cf.Header.SectorLen())
+	length := (int64(last) + 2) * sectorLen
+	if length > maxLen {
+		return maxLen
+	}
+
+	return length
+}
@@ -0,0 +1,117 @@
+package mscfb
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestFindEmbedded(t *testing.T) {
+	first := testFile{entries: []testEntry{
+		{path: "/first", data: testPattern(1, 100)},
+	}}.build(t)
+	second := testFile{version: V4, entries: []testEntry{
+		{path: "/second", data: testPattern(2, 5000)},
+	}}.build(t)
+
+	// A bare signature followed by garbage must not be reported.
+	var image bytes.Buffer
+	image.Write(testPattern(3, 1000))
+	image.Write(first.data)
+	image.Write(MAGIC_NUMBER)
+	image.Write(testPattern(4, 4096-len(MAGIC_NUMBER)-(1000+len(first.data))%4096))
+	secondOffset := int64(image.Len())
+	image.Write(second.data)
+	image.Write(testPattern(5, 700))
+
+	tests := []struct {
+		name    string
+		options FindOptions
+		want    []int64
+	}{
+		{"any offset", FindOptions{}, []int64{1000, secondOffset}},
+		{"aligned only", FindOptions{AlignedOnly: true}, []int64{secondOffset}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, err := FindEmbeddedWithOptions(bytes.NewReader(image.Bytes()), int64(image.Len()), tt.options)
+			if err != nil {
+				t.Fatalf("FindEmbeddedWithOptions() error = %v", err)
+			}
+			if len(found) != len(tt.want) {
+				t.Fatalf("FindEmbeddedWithOptions() found %v files, want %v", len(found), len(tt.want))
+			}
+			for i, embedded := range found {
+				if embedded.Offset != tt.want[i] {
+					t.Errorf("file %v at offset %v, want %v", i, embedded.Offset, tt.want[i])
+				}
+			}
+		})
+	}
+
+	found, err := FindEmbedded(bytes.NewReader(image.Bytes()), int64(image.Len()))
+	if err != nil {
+		t.Fatalf("FindEmbedded() error = %v", err)
+	}
+	for i, img := range []*testImage{first, second} {
+		if found[i].Length != int64(len(img.data)) {
+			t.Errorf("file %v is %v bytes long, want %v", i, found[i].Length, len(img.data))
+		}
+	}
+
+	stream, err := found[1].CompoundFile.OpenStream("/second")
+	if err != nil {
+		t.Fatalf("OpenStream() error = %v", err)
+	}
+	data, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if !bytes.Equal(data, testPattern(2, 5000)) {
+		t.Errorf("embedded stream doesn't match")
+	}
+}
+
+// recordingReaderAt records the furthest offset read.
+type recordingReaderAt struct {
+	io.ReaderAt
+	end int64
+}
+
+func (r *recordingReaderAt) ReadAt(p []byte, offset int64) (int, error) {
+	n, err := r.ReaderAt.ReadAt(p, offset)
+	if end := offset + int64(n); end > r.end {
+		r.end = end
+	}
+	return n, err
+}
+
+func TestOpenEmbeddedAtBounded(t *testing.T) {
+	img := testFile{entries: []testEntry{
+		{path: "/stream", data: testPattern(1, 100)},
+	}}.build(t)
+
+	// The scanned file is larger than any compound file with 512-byte
+	// sectors can be, but the file found only sees what its one FAT sector
+	// can allocate.
+	reader := &recordingReaderAt{ReaderAt: bytes.NewReader(img.data)}
+	embedded := openEmbeddedAt(reader, 0, 1<<42, OpenOptions{})
+	if embedded == nil {
+		t.Fatalf("openEmbeddedAt() = nil")
+	}
+	if embedded.Length != int64(len(img.data)) {
+		t.Errorf("openEmbeddedAt() length = %v, want %v", embedded.Length, len(img.data))
+	}
+
+	// A hit whose header doesn't check out is dropped after reading it.
+	bad := append([]byte(nil), img.data...)
+	bad[28] = 0
+	reader = &recordingReaderAt{ReaderAt: bytes.NewReader(bad)}
+	if openEmbeddedAt(reader, 0, int64(len(bad)), OpenOptions{}) != nil {
+		t.Errorf("openEmbeddedAt() with a bad byte order mark succeeded")
+	}
+	if reader.end > int64(HEADER_LEN) {
+		t.Errorf("openEmbeddedAt() read up to %v for a bad header", reader.end)
+	}
+}
@@ -5,13 +5,24 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+
+	"github.com/google/uuid"
 )
 
+// Header holds every field of the 512-byte CFB file header, including the
+// reserved ones, exactly as found on disk.
 type Header struct {
+	CLSID              uuid.UUID
+	MinorVersion       uint16
 	Version            Version
+	SectorShift        uint16
+	MiniSectorShift    uint16
+	MiniStreamCutoff   uint32
+	Reserved           [6]byte
 	NumDirSectors      uint32
 	NumFatSectors      uint32
 	FirstDirSector     uint32
+	TransactionSign    uint32
 	FirstMinifatSector uint32
 	NumMinifatSector   uint32
 	FirstDifatSector   uint32
@@ -21,11 +32,26 @@ type Header struct {
 }
 
 const (
-	reservedAfterMagicNumber = 16
-	reservedAfterMiniShift   = 6
+	reservedAfterMiniShift = 6
+
+	// Range of sector shifts accepted under Permissive validation. Sectors
+	// smaller than the 512-byte header can't be addressed, and anything past
+	// 64 KiB isn't produced by any known writer.
+	minSectorShift uint16 = 9
+	maxSectorShift uint16 = 16
 )
 
-func (h *Header) readFrom(reader io.ReadSeeker) error {
+// Returns the length of the sectors declared in this header.
+func (h *Header) SectorLen() int {
+	return 1 << int(h.SectorShift)
+}
+
+// Returns the length of the mini sectors declared in this header.
+func (h *Header) MiniSectorLen() int {
+	return 1 << int(h.MiniSectorShift)
+}
+
+func (h *Header) readFrom(reader io.ReadSeeker, validation Validation) error {
 	magicPart := make([]byte, len(MAGIC_NUMBER))
 	_, err := reader.Read(magicPart)
 	if err != nil {
@@ -36,8 +62,7 @@ func (h *Header) readFrom(reader io.ReadSeeker) error {
 		return ErrorInvalidCFB
 	}
 
-	// seek reserved field
-	_, err = reader.Seek(reservedAfterMagicNumber, io.SeekCurrent)
+	clsid, err := readUuid(reader)
 	if err != nil {
 		return err
 	}
@@ -75,7 +100,11 @@ func (h *Header) readFrom(reader io.ReadSeeker) error {
 		return err
 	}
 	if sectorShift != version.SectorShift() {
-		return fmt.Errorf("incorrect sector shift for CFB version %v (expected %v, found %v)", version, version.SectorShift(), sectorShift)
+		// Some writers produce e.g. V3 files with 4096-byte sectors. Under
+		// Permissive validation we honor the declared sector shift.
+		if validation.IsStrict() || sectorShift < minSectorShift || sectorShift > maxSectorShift {
+			return fmt.Errorf("incorrect sector shift for CFB version %v (expected %v, found %v)", version, version.SectorShift(), sectorShift)
+		}
 	}
 
 	var miniSectorShift uint16
@@ -84,11 +113,13 @@ func (h *Header) readFrom(reader io.ReadSeeker) error {
 		return err
 	}
 	if miniSectorShift != MINI_SECTOR_SHIFT {
-		return fmt.Errorf("incorrect mini sector shift (expected %v, found %v)", MINI_SECTOR_SHIFT, miniSectorShift)
+		if validation.IsStrict() || miniSectorShift == 0 || miniSectorShift >= sectorShift {
+			return fmt.Errorf("incorrect mini sector shift (expected %v, found %v)", MINI_SECTOR_SHIFT, miniSectorShift)
+		}
 	}
 
-	// seek reserved field
-	_, err = reader.Seek(reservedAfterMiniShift, io.SeekCurrent)
+	var reserved [reservedAfterMiniShift]byte
+	_, err = io.ReadFull(reader, reserved[:])
 	if err != nil {
 		return err
 	}
@@ -123,7 +154,7 @@ func (h *Header) readFrom(reader io.ReadSeeker) error {
 	if err != nil {
 		return err
 	}
-	if miniStreamCutoff != MINI_STREAM_CUTOFF {
+	if miniStreamCutoff != MINI_STREAM_CUTOFF && validation.IsStrict() {
 		return fmt.Errorf("incorrect mini stream cutoff (expected %v, found %v)", MINI_STREAM_CUTOFF, miniStreamCutoff)
 	}
 
@@ -152,34 +183,33 @@ func (h *Header) readFrom(reader io.ReadSeeker) error {
 		return err
 	}
 
-	// Some CFB implementations use FREE_SECTOR to indicate END_OF_CHAIN.
-	if firstDifatSector == FREE_SECTOR {
-		firstDifatSector = END_OF_CHAIN
-	}
-
+	// All 109 entries are kept as-is so the header can be written back
+	// unchanged; only the ones before the first free entry are in use.
 	difatEntries := make([]uint32, NUM_DIFAT_ENTRIES_IN_HEADER)
+	err = binary.Read(reader, binary.LittleEndian, difatEntries)
+	if err != nil {
+		return err
+	}
 
-	for i := range difatEntries {
-
-		var next uint32
-		err = binary.Read(reader, binary.LittleEndian, &next)
-		if err != nil {
-			return err
-		}
-
+	for _, next := range difatEntries {
 		if next == FREE_SECTOR {
 			break
 		} else if next > MAX_REGULAR_SECTOR {
 			return fmt.Errorf("invalid DIFAT entry (expected value <= %v, found %v)", MAX_REGULAR_SECTOR, next)
-
 		}
-		difatEntries[i] = next
 	}
 
+	h.CLSID = clsid
+	h.MinorVersion = minorVersion
 	h.Version = version
+	h.SectorShift = sectorShift
+	h.MiniSectorShift = miniSectorShift
+	h.MiniStreamCutoff = miniStreamCutoff
+	h.Reserved = reserved
 	h.NumDirSectors = numDirSectors
 	h.NumFatSectors = numFatSectors
 	h.FirstDirSector = firstDirSector
+	h.TransactionSign = transactionSign
 	h.FirstMinifatSector = firstMinifatSector
 	h.NumMinifatSector = numMinifatSectors
 	h.FirstDifatSector = firstDifatSector
@@ -188,3 +218,56 @@ func (h *Header) readFrom(reader io.ReadSeeker) error {
 
 	return nil
 }
+
+// Returns the DIFAT entries stored in the header that are in use, i.e. those
+// before the first free entry.
+func (h *Header) UsedDifatEntries() []uint32 {
+	for i, entry := range h.InitialDifatEntries {
+		if entry == FREE_SECTOR {
+			return h.InitialDifatEntries[:i]
+		}
+	}
+
+	return h.InitialDifatEntries
+}
+
+// Writes the 512-byte header, reserved fields included. Any padding up to
+// the first sector of a file with larger sectors is not written.
+func (h *Header) WriteTo(w io.Writer) (int64, error) {
+	if len(h.InitialDifatEntries) > NUM_DIFAT_ENTRIES_IN_HEADER {
+		return 0, fmt.Errorf("header has %v DIFAT entries, but only %v fit",
+			len(h.InitialDifatEntries), NUM_DIFAT_ENTRIES_IN_HEADER)
+	}
+
+	buf := make([]byte, HEADER_LEN)
+	le := binary.LittleEndian
+
+	copy(buf[0:], MAGIC_NUMBER)
+	writeUuid(buf[8:24], h.CLSID)
+	le.PutUint16(buf[24:], h.MinorVersion)
+	le.PutUint16(buf[26:], uint16(h.Version))
+	le.PutUint16(buf[28:], BYTE_ORDER_MARK)
+	le.PutUint16(buf[30:], h.SectorShift)
+	le.PutUint16(buf[32:], h.MiniSectorShift)
+	copy(buf[34:40], h.Reserved[:])
+	le.PutUint32(buf[40:], h.NumDirSectors)
+	le.PutUint32(buf[44:], h.NumFatSectors)
+	le.PutUint32(buf[48:], h.FirstDirSector)
+	le.PutUint32(buf[52:], h.TransactionSign)
+	le.PutUint32(buf[56:], h.MiniStreamCutoff)
+	le.PutUint32(buf[60:], h.FirstMinifatSector)
+	le.PutUint32(buf[64:], h.NumMinifatSector)
+	le.PutUint32(buf[68:], h.FirstDifatSector)
+	le.PutUint32(buf[72:], h.NumDifatSectors)
+
+	for i := 0; i < NUM_DIFAT_ENTRIES_IN_HEADER; i++ {
+		entry := FREE_SECTOR
+		if i < len(h.InitialDifatEntries) {
+			entry = h.InitialDifatEntries[i]
+		}
+		le.PutUint32(buf[76+4*i:], entry)
+	}
+
+	n, err := w.Write(buf)
+	return int64(n), err
+}
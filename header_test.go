@@ -0,0 +1,59 @@
+package mscfb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestHeaderWriteTo(t *testing.T) {
+	img := testFile{
+		version: V4,
+		entries: []testEntry{{path: "/stream", data: testPattern(1, 5000)}},
+	}.build(t)
+
+	// Fill the fields the builder leaves zeroed, and a stale DIFAT entry
+	// after the first free one, so they're known to survive the round trip.
+	le := binary.LittleEndian
+	copy(img.data[8:24], []byte("producer-clsid!!"))
+	le.PutUint16(img.data[24:], 0x3b)
+	copy(img.data[34:40], []byte{1, 2, 3, 4, 5, 6})
+	le.PutUint32(img.data[52:], 0xdeadbeef)
+	le.PutUint32(img.data[76+4*100:], 42)
+
+	cf, err := Open(bytes.NewReader(img.data), ValidationPermissive)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	h := cf.Header
+	if h.MinorVersion != 0x3b {
+		t.Errorf("MinorVersion = %#x, want %#x", h.MinorVersion, 0x3b)
+	}
+	if h.TransactionSign != 0xdeadbeef {
+		t.Errorf("TransactionSign = %#x, want %#x", h.TransactionSign, 0xdeadbeef)
+	}
+	if h.Reserved != [6]byte{1, 2, 3, 4, 5, 6} {
+		t.Errorf("Reserved = %v", h.Reserved)
+	}
+	if h.CLSID == uuid.Nil {
+		t.Errorf("CLSID = %v, want non-nil", h.CLSID)
+	}
+	if len(h.UsedDifatEntries()) != int(h.NumFatSectors) {
+		t.Errorf("UsedDifatEntries() has %v entries, want %v", len(h.UsedDifatEntries()), h.NumFatSectors)
+	}
+
+	var buf bytes.Buffer
+	n, err := h.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	if n != int64(HEADER_LEN) {
+		t.Errorf("WriteTo() = %v, want %v", n, HEADER_LEN)
+	}
+	if !bytes.Equal(buf.Bytes(), img.data[:HEADER_LEN]) {
+		t.Errorf("WriteTo() did not round-trip the header")
+	}
+}
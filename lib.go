@@ -1,15 +1,17 @@
 package mscfb
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
-	"unsafe"
+	"sync"
 )
 
 var (
 	ErrorInvalidCFB = errors.New("invalid cfb file")
+	ErrTruncated    = errors.New("cfb file is truncated")
 )
 
 type CompoundFile struct {
@@ -18,9 +20,83 @@ type CompoundFile struct {
 	Header    *Header
 	Directory *Directory
 	MiniAlloc *MiniAlloc
+
+	layoutOnce sync.Once
+	layout     *layout
+	layoutErr  error
+
+	// closer releases the file or mapping behind a file opened with
+	// OpenFile, or the reader if it is owned; closed is set by Close.
+	closer func() error
+	closed bool
+}
+
+// OpenOptions controls how a compound file is opened.
+type OpenOptions struct {
+	Validation Validation
+
+	// Recover opens as much of a truncated file as possible instead of
+	// failing: directory entries and streams are available up to the point
+	// where the file ends, and reading past it returns ErrTruncated. It
+	// implies ValidationPermissive.
+	Recover bool
+
+	// LazyFat reads FAT sectors as chains are followed instead of loading
+	// the whole FAT up front, keeping the FatCacheSectors most recently
+	// used ones decoded (DEFAULT_FAT_CACHE_SECTORS if not set). Memory use
+	// then stays constant however large the file is, but the FAT isn't
+	// validated as a whole.
+	LazyFat         bool
+	FatCacheSectors int
+
+	// SectorCacheBytes, if positive, keeps up to that many bytes of recently
+	// read sectors in memory, so that rereading them, e.g. the sectors
+	// holding the mini stream, doesn't go back to the reader. See
+	// CompoundFile.CacheStats.
+	SectorCacheBytes int64
+	// SectorCache, if set, takes the place of that cache, to use a different
+	// policy; SectorCacheBytes is then ignored. See NewLRUSectorCache for
+	// the default.
+	SectorCache SectorCache
+
+	// OwnReader hands the reader over to the compound file once it is
+	// opened: Close then also closes the reader, if it is an io.Closer.
+	// Files opened with OpenFile or OpenStream always own their file.
+	OwnReader bool
 }
 
 func Open(reader io.ReadSeeker, validation Validation) (*CompoundFile, error) {
+	return OpenWithOptions(reader, OpenOptions{Validation: validation})
+}
+
+func OpenWithOptions(reader io.ReadSeeker, options OpenOptions) (*CompoundFile, error) {
+	return OpenContext(context.Background(), reader, options)
+}
+
+// Like OpenWithOptions, but gives up with ctx's error if ctx is cancelled
+// while the allocation tables and directory are read.
+func OpenContext(ctx context.Context, reader io.ReadSeeker, options OpenOptions) (*CompoundFile, error) {
+	cf, err := openCompoundFile(ctx, reader, nil, options)
+	if err != nil {
+		return nil, err
+	}
+
+	if closer, ok := reader.(io.Closer); ok && options.OwnReader {
+		cf.closer = closer.Close
+	}
+
+	return cf, nil
+}
+
+// Opens a compound file from reader. If mapped is set, it holds the same
+// bytes as reader, and sectors are served from it directly. Reading the
+// allocation tables and directory stops early if ctx is cancelled.
+func openCompoundFile(ctx context.Context, reader io.ReadSeeker, mapped []byte, options OpenOptions) (*CompoundFile, error) {
+	validation := options.Validation
+	if options.Recover {
+		validation = ValidationPermissive
+	}
+
 	bufLen, err := reader.Seek(0, io.SeekEnd)
 	if err != nil {
 		return nil, err
@@ -41,36 +117,57 @@ func Open(reader io.ReadSeeker, validation Validation) (*CompoundFile, error) {
 	}
 
 	header := &Header{}
-	err = header.readFrom(reader)
+	err = header.readFrom(reader, validation)
 	if err != nil {
 		return nil, err
 	}
 
-	sectorLen := header.Version.SectorLen()
+	sectorLen := header.SectorLen()
 	if bufLen > ((int64(MAX_REGULAR_SECTOR) + 1) * int64(sectorLen)) {
 		return nil, fmt.Errorf("file is too large: %w", ErrorInvalidCFB)
 	}
 
-	if bufLen < int64(sectorLen) {
+	if bufLen < int64(sectorLen) && !options.Recover {
 		return nil, fmt.Errorf("file is too small: %w", ErrorInvalidCFB)
 	}
 
-	sectors := NewSectors(header.Version, bufLen, reader)
+	sectors := NewSectors(header.Version, header.SectorShift, bufLen, reader)
+	if mapped != nil {
+		sectors.data = mapped
+	} else if options.SectorCache != nil {
+		sectors.cache = newSectorCache(options.SectorCache)
+	} else if options.SectorCacheBytes > 0 {
+		sectors.cache = newSectorCache(NewLRUSectorCache(options.SectorCacheBytes))
+	}
+	fileSectors := sectors.NumSectors
 
-	difat := make([]uint32, len(header.InitialDifatEntries))
-	copy(difat, header.InitialDifatEntries)
+	difat := make([]uint32, len(header.UsedDifatEntries()))
+	copy(difat, header.UsedDifatEntries())
 
 	seenSectorIds := make(map[uint32]bool)
 	difatSectorIds := make([]uint32, 0)
 	currentDifatSector := header.FirstDifatSector
 
-	var sz uint32
-	uSize := unsafe.Sizeof(sz)
+	// Some CFB implementations use FREE_SECTOR to indicate END_OF_CHAIN.
+	if currentDifatSector == FREE_SECTOR {
+		currentDifatSector = END_OF_CHAIN
+	}
+
+	// Allocation tables and the directory are read a whole sector at a
+	// time and decoded from the buffer.
+	buf := make([]byte, sectors.SectorLen())
+	entriesPerSector := sectors.SectorLen() / 4
 
 	for currentDifatSector != END_OF_CHAIN {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		if currentDifatSector > MAX_REGULAR_SECTOR {
 			return nil, fmt.Errorf("invalid DIFAT chain: %w", ErrorInvalidCFB)
 		} else if currentDifatSector >= sectors.NumSectors {
+			if options.Recover {
+				break
+			}
 			return nil, fmt.Errorf("invalid DIFAT chain includes sector index: %w", ErrorInvalidCFB)
 		}
 
@@ -81,28 +178,26 @@ func Open(reader io.ReadSeeker, validation Validation) (*CompoundFile, error) {
 		seenSectorIds[currentDifatSector] = true
 		difatSectorIds = append(difatSectorIds, currentDifatSector)
 
-		sector, err := sectors.SeekToSector(currentDifatSector)
-		if err != nil {
+		n, err := sectors.readSector(currentDifatSector, buf)
+		truncated := err == ErrTruncated && options.Recover
+		if err != nil && !truncated {
 			return nil, err
 		}
 
-		for i := 0; i < (sectors.SectorLen()/int(uSize) - 1); i++ {
-			var next uint32
-			err = binary.Read(sector.reader, binary.LittleEndian, &next)
-			if err != nil {
-				return nil, err
-			}
-
+		// The last entry links to the next DIFAT sector.
+		numEntries := min(uint64(n/4), uint64(entriesPerSector-1))
+		for i := uint64(0); i < numEntries; i++ {
+			next := binary.LittleEndian.Uint32(buf[i*4:])
 			if next != FREE_SECTOR && next > MAX_REGULAR_SECTOR {
 				return nil, fmt.Errorf("invalid DIFAT refers to invalid sector index %v", next)
 			}
 			difat = append(difat, next)
 		}
 
-		err = binary.Read(sector.reader, binary.LittleEndian, &currentDifatSector)
-		if err != nil {
-			return nil, err
+		if truncated {
+			break
 		}
+		currentDifatSector = binary.LittleEndian.Uint32(buf[(entriesPerSector-1)*4:])
 	}
 
 	if validation.IsStrict() &&
@@ -125,43 +220,23 @@ func Open(reader io.ReadSeeker, validation Validation) (*CompoundFile, error) {
 			header.NumFatSectors, len(difat))
 	}
 
-	fat := make([]uint32, 0)
-	for _, sectorId := range difat {
-		if sectorId >= sectors.NumSectors {
-			return nil, fmt.Errorf("invalid FAT sector index: %w", ErrorInvalidCFB)
+	var allocator *Allocator
+	if options.LazyFat {
+		fat := newLazyFat(sectors, difat, options.FatCacheSectors, options.Recover)
+		if options.Recover && fat.Len() > sectors.NumSectors {
+			sectors.NumSectors = fat.Len()
 		}
-
-		sector, err := sectors.SeekToSector(sectorId)
+		allocator = newLazyAllocator(sectors, difatSectorIds, difat, fat, validation)
+	} else {
+		fat, err := readFat(ctx, sectors, difat, buf, validation, options.Recover)
 		if err != nil {
 			return nil, err
 		}
-		for i := 0; i < sectors.SectorLen()/int(uSize); i++ {
-			var next uint32
-			err = binary.Read(sector.reader, binary.LittleEndian, &next)
-			if err != nil {
-				return nil, err
-			}
-			fat = append(fat, next)
-		}
-	}
 
-	//fat pop
-	if !validation.IsStrict() {
-		for len(fat) > int(sectors.NumSectors) && fat[len(fat)-1] == 0 {
-			fat = fat[:len(fat)-1]
-		}
-	}
-
-	for i := len(fat) - 1; i >= 0; i-- {
-		if fat[i] != FREE_SECTOR {
-			break
+		allocator, err = NewAllocator(sectors, difatSectorIds, difat, fat, validation)
+		if err != nil {
+			return nil, err
 		}
-		fat = fat[:i]
-	}
-
-	allocator, err := NewAllocator(sectors, difatSectorIds, difat, fat, validation)
-	if err != nil {
-		return nil, err
 	}
 
 	// Read in directory.
@@ -170,10 +245,15 @@ func Open(reader io.ReadSeeker, validation Validation) (*CompoundFile, error) {
 	currentDirSector := header.FirstDirSector
 
 	for currentDirSector != END_OF_CHAIN {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		if currentDirSector > MAX_REGULAR_SECTOR {
 			return nil, fmt.Errorf("invalid directory chain: %w", ErrorInvalidCFB)
 		} else if currentDirSector >= sectors.NumSectors {
 			return nil, fmt.Errorf("invalid directory chain includes sector index: %w", ErrorInvalidCFB)
+		} else if currentDirSector >= fileSectors && options.Recover {
+			break
 		}
 
 		if seenDirSectors[currentDirSector] {
@@ -182,13 +262,14 @@ func Open(reader io.ReadSeeker, validation Validation) (*CompoundFile, error) {
 
 		seenDirSectors[currentDirSector] = true
 
-		_, err = allocator.SeekToSector(currentDirSector)
-		if err != nil {
+		n, err := sectors.readSector(currentDirSector, buf)
+		if err != nil && !(err == ErrTruncated && options.Recover) {
 			return nil, err
 		}
 
-		for i := 0; i < header.Version.DirEntriesPerSector(); i++ {
-			entry, err := ReadDirEntry(reader, header.Version, validation)
+		numEntries := n / DIR_ENTRY_LEN
+		for i := 0; i < numEntries; i++ {
+			entry, err := DecodeDirEntry(buf[i*DIR_ENTRY_LEN:], header.Version, validation)
 			if err != nil {
 				return nil, err
 			}
@@ -196,13 +277,25 @@ func Open(reader io.ReadSeeker, validation Validation) (*CompoundFile, error) {
 			dirEntries = append(dirEntries, entry)
 		}
 
+		if numEntries < sectors.SectorLen()/DIR_ENTRY_LEN {
+			break
+		}
+
 		currentDirSector, err = allocator.Next(currentDirSector)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	directory, err := NewDirectory(allocator, dirEntries, header.FirstDirSector)
+	if options.Recover {
+		if len(dirEntries) == 0 {
+			return nil, fmt.Errorf("directory is missing: %w", ErrTruncated)
+		}
+
+		pruneMissingDirEntries(dirEntries)
+	}
+
+	directory, err := NewDirectory(allocator, dirEntries, header.FirstDirSector, header.MiniSectorLen())
 	if err != nil {
 		return nil, err
 	}
@@ -217,16 +310,21 @@ func Open(reader io.ReadSeeker, validation Validation) (*CompoundFile, error) {
 			header.NumMinifatSector, chain.NumSectors())
 	}
 
-	numMinifatEntries := uint32(chain.Len() / 4)
-	minifat := make([]uint32, 0)
+	minifatBuf := make([]byte, chain.Len())
+	n, err := chain.ReadAll(minifatBuf)
+	if err != nil && !(err == ErrTruncated && options.Recover) {
+		return nil, err
+	}
 
-	p := []byte{0, 0, 0, 0}
-	for i := uint32(0); i < numMinifatEntries; i++ {
-		_, err := chain.Read(p)
-		if err != nil {
-			return nil, err
+	minifat := appendUint32s(make([]uint32, 0, n/4), minifatBuf[:n])
+	if n < len(minifatBuf) {
+		// Treat the missing entries like missing FAT entries, but don't
+		// claim more mini sectors than the mini stream holds.
+		rootMiniSectors := directory.RootDirEntry().StreamSize / uint64(header.MiniSectorLen())
+		missing := int(min(uint64(len(minifatBuf)/4), rootMiniSectors)) - len(minifat)
+		if missing > 0 {
+			minifat = appendMissingFatEntries(minifat, missing)
 		}
-		minifat = append(minifat, binary.LittleEndian.Uint32(p))
 	}
 
 	for i := len(minifat) - 1; i >= 0; i-- {
@@ -236,12 +334,12 @@ func Open(reader io.ReadSeeker, validation Validation) (*CompoundFile, error) {
 		minifat = minifat[:i]
 	}
 
-	miniAlloc, err := NewMiniAlloc(directory, minifat, header.FirstMinifatSector)
+	miniAlloc, err := NewMiniAlloc(directory, minifat, header.FirstMinifatSector, header.MiniSectorLen())
 	if err != nil {
 		return nil, err
 	}
 
-	compoundFile := CompoundFile{
+	compoundFile := &CompoundFile{
 		Reader: reader,
 
 		Header:    header,
@@ -249,16 +347,122 @@ func Open(reader io.ReadSeeker, validation Validation) (*CompoundFile, error) {
 		MiniAlloc: miniAlloc,
 	}
 
-	return &compoundFile, nil
+	return compoundFile, nil
+}
+
+// Reads the whole FAT from the sectors listed in the DIFAT, dropping the
+// free entries at its end.
+func readFat(ctx context.Context, sectors *Sectors, difat []uint32, buf []byte, validation Validation, recover bool) ([]uint32, error) {
+	entriesPerSector := sectors.SectorLen() / 4
+	fat := make([]uint32, 0, len(difat)*entriesPerSector)
+	for _, sectorId := range difat {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if sectorId >= sectors.NumSectors {
+			if recover {
+				fat = appendMissingFatEntries(fat, entriesPerSector)
+				continue
+			}
+			return nil, fmt.Errorf("invalid FAT sector index: %w", ErrorInvalidCFB)
+		}
+
+		n, err := sectors.readSector(sectorId, buf)
+		if err != nil && !(err == ErrTruncated && recover) {
+			return nil, err
+		}
+
+		fat = appendUint32s(fat, buf[:n])
+		if n < sectors.SectorLen() {
+			fat = appendMissingFatEntries(fat, entriesPerSector-n/4)
+		}
+	}
+
+	//fat pop
+	if !validation.IsStrict() {
+		for len(fat) > int(sectors.NumSectors) && fat[len(fat)-1] == 0 {
+			fat = fat[:len(fat)-1]
+		}
+	}
+
+	for i := len(fat) - 1; i >= 0; i-- {
+		if fat[i] != FREE_SECTOR {
+			break
+		}
+		fat = fat[:i]
+	}
+
+	// Sectors past the end of a truncated file are still addressable, so
+	// that chains running into them can be followed up to that point.
+	if recover && uint32(len(fat)) > sectors.NumSectors {
+		sectors.NumSectors = uint32(len(fat))
+	}
+
+	return fat, nil
+}
+
+// Stands in for FAT (or MiniFAT) entries whose sectors are missing from a
+// truncated file. Chains that reach them simply end there.
+func appendMissingFatEntries(fat []uint32, n int) []uint32 {
+	for i := 0; i < n; i++ {
+		fat = append(fat, END_OF_CHAIN)
+	}
+
+	return fat
+}
+
+// Detaches tree links that point at directory entries missing from a
+// truncated file.
+func pruneMissingDirEntries(dirEntries []*DirEntry) {
+	numEntries := uint32(len(dirEntries))
+	for _, dirEntry := range dirEntries {
+		if dirEntry.LeftSibling != NO_STREAM && dirEntry.LeftSibling >= numEntries {
+			dirEntry.LeftSibling = NO_STREAM
+		}
+		if dirEntry.RightSibling != NO_STREAM && dirEntry.RightSibling >= numEntries {
+			dirEntry.RightSibling = NO_STREAM
+		}
+		if dirEntry.Child != NO_STREAM && dirEntry.Child >= numEntries {
+			dirEntry.Child = NO_STREAM
+		}
+	}
 }
 
 func (c *CompoundFile) RootEntry() *Entry {
 	return NewEntry(c.Directory.RootDirEntry(), "/")
 }
 
+// Returns an iterator over every entry in the file, starting with the root
+// entry, in preorder.
+func (c *CompoundFile) Walk() *Entries {
+	if err := c.checkOpen(); err != nil {
+		return &Entries{Stack: make([]*EntriesStack, 0), err: err}
+	}
+
+	return NewEntries(EntriesPreorder, c.Directory, PathFromNameChain([]string{}), ROOT_STREAM_ID)
+}
+
+// Like Walk, but the walk ends once ctx is cancelled, after which
+// Entries.Err returns ctx's error.
+func (c *CompoundFile) WalkContext(ctx context.Context) *Entries {
+	entries := c.Walk()
+	entries.ctx = ctx
+	return entries
+}
+
 func (c *CompoundFile) OpenStream(path string) (*Stream, error) {
-	names := NameChainFromPath(path)
-	path = PathFromNameChain(names)
+	return c.OpenStreamByNames(NameChainFromPath(path))
+}
+
+// Opens the stream addressed by a chain of unescaped entry names, such as
+// Entry.NameChain. Unlike OpenStream, the names are used as-is.
+func (c *CompoundFile) OpenStreamByNames(names []string) (*Stream, error) {
+	if err := c.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	path := PathFromNameChain(names)
 	streamId, err := c.MiniAlloc.StreamIDForNameChain(names)
 	if err != nil {
 		return nil, err
@@ -277,6 +481,10 @@ func (c *CompoundFile) OpenStream(path string) (*Stream, error) {
 }
 
 func (c *CompoundFile) Exists(path string) (bool, error) {
+	if err := c.checkOpen(); err != nil {
+		return false, err
+	}
+
 	names := NameChainFromPath(path)
 	if len(names) == 0 {
 		return false, nil
@@ -291,6 +499,10 @@ func (c *CompoundFile) Exists(path string) (bool, error) {
 }
 
 func (c *CompoundFile) IsStream(path string) (bool, error) {
+	if err := c.checkOpen(); err != nil {
+		return false, err
+	}
+
 	names := NameChainFromPath(path)
 	if len(names) == 0 {
 		return false, nil
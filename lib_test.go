@@ -0,0 +1,284 @@
+package mscfb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestOpen(t *testing.T) {
+	entries := []testEntry{
+		{path: "/empty", data: []byte{}},
+		{path: "/small", data: testPattern(1, 100)},
+		{path: "/storage/nested", data: testPattern(2, 3000)},
+		{path: "/storage/large", data: testPattern(3, 20000)},
+		{path: "/\x05SummaryInformation", data: testPattern(4, 4096)},
+	}
+
+	tests := []struct {
+		name       string
+		file       testFile
+		validation Validation
+		wantErr    bool
+	}{
+		{
+			name:       "v3",
+			file:       testFile{version: V3, entries: entries},
+			validation: ValidationStrict,
+		},
+		{
+			name:       "v4",
+			file:       testFile{version: V4, entries: entries},
+			validation: ValidationStrict,
+		},
+		{
+			name:       "v3 with 4096-byte sectors",
+			file:       testFile{version: V3, sectorShift: 12, entries: entries},
+			validation: ValidationPermissive,
+		},
+		{
+			name:       "v3 with 4096-byte sectors strict",
+			file:       testFile{version: V3, sectorShift: 12, entries: entries},
+			validation: ValidationStrict,
+			wantErr:    true,
+		},
+		{
+			name:       "v4 with 512-byte sectors",
+			file:       testFile{version: V4, sectorShift: 9, entries: entries},
+			validation: ValidationPermissive,
+		},
+		{
+			name:       "128-byte mini sectors",
+			file:       testFile{version: V3, miniShift: 7, entries: entries},
+			validation: ValidationPermissive,
+		},
+		{
+			name:       "128-byte mini sectors strict",
+			file:       testFile{version: V3, miniShift: 7, entries: entries},
+			validation: ValidationStrict,
+			wantErr:    true,
+		},
+		{
+			name:       "mini stream cutoff 1024",
+			file:       testFile{version: V3, cutoff: 1024, entries: entries},
+			validation: ValidationPermissive,
+		},
+		{
+			name:       "mini stream cutoff 8192",
+			file:       testFile{version: V4, cutoff: 8192, entries: entries},
+			validation: ValidationPermissive,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := tt.file.build(t)
+			cf, err := Open(bytes.NewReader(img.data), tt.validation)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Open() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			for _, e := range entries {
+				stream, err := cf.OpenStream(e.path)
+				if err != nil {
+					t.Fatalf("OpenStream(%v) error = %v", e.path, err)
+				}
+				got, err := io.ReadAll(stream)
+				if err != nil {
+					t.Fatalf("ReadAll(%v) error = %v", e.path, err)
+				}
+				if !bytes.Equal(got, e.data) {
+					t.Errorf("stream %v: got %v bytes, want %v bytes", e.path, len(got), len(e.data))
+				}
+			}
+		})
+	}
+}
+
+// A preorder walk visits storages before their children, and storages'
+// children in directory order, which puts shorter names first.
+func TestEntriesPreorder(t *testing.T) {
+	img := testFile{entries: []testEntry{
+		{path: "/small", data: testPattern(1, 100)},
+		{path: "/storage/nested", data: testPattern(2, 3000)},
+		{path: "/storage/inner/deep", data: testPattern(3, 10)},
+	}}.build(t)
+	cf, err := Open(bytes.NewReader(img.data), ValidationStrict)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	got := make([]string, 0)
+	entries := NewEntries(EntriesPreorder, cf.Directory, PathFromNameChain([]string{}), ROOT_STREAM_ID)
+	for entry := entries.Next(); entry != nil; entry = entries.Next() {
+		got = append(got, entry.Path)
+	}
+
+	want := []string{"/", "/small", "/storage", "/storage/inner", "/storage/inner/deep", "/storage/nested"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("preorder walk = %v, want %v", got, want)
+	}
+}
+
+func TestOpenRecoverTruncated(t *testing.T) {
+	entries := []testEntry{
+		{path: "/small", data: testPattern(1, 100)},
+		{path: "/first", data: testPattern(2, 5000)},
+		{path: "/second", data: testPattern(3, 5000)},
+	}
+	img := testFile{version: V3, metaFirst: true, entries: entries}.build(t)
+
+	// Cut the file halfway through the third sector of /second.
+	second, err := Open(bytes.NewReader(img.data), ValidationStrict)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	secondStart := second.Directory.DirEntries[img.dirIds["/second"]].StartingSector
+	cut := img.sectorOffset(secondStart+2) + 100
+	truncated := img.data[:cut]
+
+	if _, err := Open(bytes.NewReader(truncated), ValidationStrict); err == nil {
+		t.Fatalf("Open() of truncated file succeeded without Recover")
+	}
+
+	cf, err := OpenWithOptions(bytes.NewReader(truncated), OpenOptions{Recover: true})
+	if err != nil {
+		t.Fatalf("OpenWithOptions() error = %v", err)
+	}
+
+	statuses, err := cf.StreamStatuses()
+	if err != nil {
+		t.Fatalf("StreamStatuses() error = %v", err)
+	}
+	want := map[string]uint64{"/small": 100, "/first": 5000, "/second": 2*512 + 100}
+	if len(statuses) != len(want) {
+		t.Fatalf("StreamStatuses() returned %v streams, want %v", len(statuses), len(want))
+	}
+	for _, status := range statuses {
+		if status.Available != want[status.Path] {
+			t.Errorf("%v: Available = %v, want %v", status.Path, status.Available, want[status.Path])
+		}
+		if status.IsComplete() != (status.Path != "/second") {
+			t.Errorf("%v: IsComplete() = %v", status.Path, status.IsComplete())
+		}
+	}
+
+	stream, err := cf.OpenStream("/second")
+	if err != nil {
+		t.Fatalf("OpenStream() error = %v", err)
+	}
+	got, err := io.ReadAll(stream)
+	if !errors.Is(err, ErrTruncated) {
+		t.Errorf("ReadAll() error = %v, want %v", err, ErrTruncated)
+	}
+	if !bytes.Equal(got, entries[2].data[:len(got)]) || uint64(len(got)) != want["/second"] {
+		t.Errorf("ReadAll() returned %v bytes, want the first %v", len(got), want["/second"])
+	}
+}
+
+func TestOpenRecoverMissingFat(t *testing.T) {
+	entries := []testEntry{
+		{path: "/small", data: testPattern(1, 100)},
+		{path: "/large", data: testPattern(2, 5000)},
+	}
+	img := testFile{version: V3, entries: entries}.build(t)
+
+	// The FAT is the last sector; without it every chain ends after its
+	// first sector.
+	cf, err := OpenWithOptions(bytes.NewReader(img.data[:img.sectorOffset(img.fatStart)]), OpenOptions{Recover: true})
+	if err != nil {
+		t.Fatalf("OpenWithOptions() error = %v", err)
+	}
+
+	stream, err := cf.OpenStream("/large")
+	if err != nil {
+		t.Fatalf("OpenStream() error = %v", err)
+	}
+	got, err := io.ReadAll(stream)
+	if !errors.Is(err, ErrTruncated) {
+		t.Errorf("ReadAll() error = %v, want %v", err, ErrTruncated)
+	}
+	if !bytes.Equal(got, entries[1].data[:512]) {
+		t.Errorf("ReadAll() returned %v bytes, want the first sector", len(got))
+	}
+}
+
+// Truncating a plain file (FAT last) loses FAT entries, which shortens the
+// mini stream's chain while mini streams still point past its new end.
+// Reading them should fail with ErrTruncated, not panic.
+func TestOpenRecoverTruncatedMiniStreams(t *testing.T) {
+	entries := []testEntry{
+		{path: "/a", data: testPattern(1, 1000)},
+		{path: "/b", data: testPattern(2, 3000)},
+		{path: "/c", data: testPattern(3, 2000)},
+		{path: "/large", data: testPattern(4, 5000)},
+	}
+	img := testFile{version: V3, entries: entries}.build(t)
+
+	for cut := len(img.data) - 1; cut > img.sectorLen*2; cut -= 300 {
+		cf, err := OpenWithOptions(bytes.NewReader(img.data[:cut]), OpenOptions{Recover: true})
+		if err != nil {
+			continue
+		}
+
+		for _, e := range entries {
+			stream, err := cf.OpenStream(e.path)
+			if err != nil {
+				continue
+			}
+			got, err := io.ReadAll(stream)
+			if err != nil && !errors.Is(err, ErrTruncated) {
+				t.Errorf("cut at %v: ReadAll(%v) error = %v, want nil or %v", cut, e.path, err, ErrTruncated)
+			}
+			if !bytes.Equal(got, e.data[:len(got)]) {
+				t.Errorf("cut at %v: ReadAll(%v) returned %v bytes not matching the stream", cut, e.path, len(got))
+			}
+		}
+	}
+}
+
+// Opening decodes the whole FAT, so its cost grows with the file size
+// unless the FAT is loaded lazily.
+func BenchmarkOpenLargeFat(b *testing.B) {
+	for _, size := range []int{1 << 20, 16 << 20, 64 << 20} {
+		img := testFile{entries: []testEntry{
+			{path: "/data", data: make([]byte, size)},
+		}}.build(b)
+
+		b.Run(fmt.Sprintf("%vMiB", size>>20), func(b *testing.B) {
+			benchmarkOpen(b, img, OpenOptions{Validation: ValidationStrict})
+		})
+		b.Run(fmt.Sprintf("%vMiBLazy", size>>20), func(b *testing.B) {
+			benchmarkOpen(b, img, OpenOptions{Validation: ValidationStrict, LazyFat: true})
+		})
+	}
+}
+
+func BenchmarkOpenLargeDirectory(b *testing.B) {
+	for _, count := range []int{256, 4096} {
+		entries := make([]testEntry, count)
+		for i := range entries {
+			entries[i] = testEntry{path: fmt.Sprintf("/storage%03d/stream%05d", i%100, i), data: testPattern(i, 10)}
+		}
+		img := testFile{entries: entries}.build(b)
+
+		b.Run(fmt.Sprintf("%vEntries", count), func(b *testing.B) {
+			benchmarkOpen(b, img, OpenOptions{Validation: ValidationStrict})
+		})
+	}
+}
+
+func benchmarkOpen(b *testing.B, img *testImage, options OpenOptions) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err := OpenWithOptions(bytes.NewReader(img.data), options)
+		if err != nil {
+			b.Fatalf("OpenWithOptions() error = %v", err)
+		}
+	}
+}
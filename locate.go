@@ -0,0 +1,270 @@
+package mscfb
+
+import "fmt"
+
+// Location describes the structure covering a byte of the file.
+type Location struct {
+	FileOffset int64
+	Role       SectorRole
+	// SectorId isn't set for bytes in the header. SectorOffset is the offset
+	// of the byte within its sector, or within the header.
+	SectorId     uint32
+	SectorOffset uint64
+	// Overlapping is set if more than one chain claims the sector; the
+	// location describes the first claim.
+	Overlapping bool
+
+	// Field names the header field, directory entry field or allocation
+	// table entry holding the byte.
+	Field string
+	// DirEntryId is the directory entry holding the byte, or NO_STREAM.
+	DirEntryId uint32
+
+	// StreamId, Path and StreamOffset locate the byte within a stream,
+	// resolving bytes of the mini stream to the stream stored there. Bytes of
+	// the mini stream that no stream owns have StreamId NO_STREAM, except
+	// past its end, where they are attributed to the root entry.
+	StreamId     uint32
+	Path         string
+	StreamOffset uint64
+	// MiniSectorId is the mini sector holding the byte, for bytes within the
+	// mini stream.
+	MiniSectorId uint32
+	// Slack is set if the byte lies past the end of its stream, in the unused
+	// tail of the stream's last sector or mini sector.
+	Slack bool
+}
+
+// layout is the ownership of every sector and mini sector, computed on the
+// first call to Locate.
+type layout struct {
+	sectorMap  []*SectorMapEntry
+	miniOwners []*miniOwner
+}
+
+type miniOwner struct {
+	streamId uint32
+	path     string
+	offset   uint64
+}
+
+// Reports which structure covers the byte at fileOffset: the header, an
+// allocation table, a directory entry, or a stream (resolving through the
+// mini stream).
+func (c *CompoundFile) Locate(fileOffset int64) (*Location, error) {
+	if err := c.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	sectors := c.Directory.Allocator.Sectors
+	if fileOffset < 0 || fileOffset >= sectors.Length {
+		return nil, fmt.Errorf("offset %v is outside the %v-byte file", fileOffset, sectors.Length)
+	}
+
+	location := &Location{
+		FileOffset: fileOffset,
+		DirEntryId: NO_STREAM,
+		StreamId:   NO_STREAM,
+	}
+
+	sectorLen := int64(sectors.SectorLen())
+	if fileOffset < sectorLen {
+		location.Role = SectorHeader
+		location.SectorOffset = uint64(fileOffset)
+		location.Field = headerField(fileOffset)
+		return location, nil
+	}
+
+	layout, err := c.getLayout()
+	if err != nil {
+		return nil, err
+	}
+	location.SectorId = uint32(fileOffset/sectorLen - 1)
+	location.SectorOffset = uint64(fileOffset % sectorLen)
+	if location.SectorId >= uint32(len(layout.sectorMap)) {
+		return nil, fmt.Errorf("offset %v is past the last sector", fileOffset)
+	}
+
+	entry := layout.sectorMap[location.SectorId]
+	location.Role = entry.Role
+	location.Overlapping = entry.IsOverlapping()
+	if len(entry.Claims) == 0 {
+		return location, nil
+	}
+
+	claim := entry.Claims[0]
+	offset := claim.Offset + location.SectorOffset
+
+	switch claim.Role {
+	case SectorDifat:
+		entriesPerSector := uint64(sectorLen/4) - 1
+		if location.SectorOffset/4 == entriesPerSector {
+			location.Field = "next DIFAT sector"
+		} else {
+			index := uint64(NUM_DIFAT_ENTRIES_IN_HEADER) + (offset/uint64(sectorLen))*entriesPerSector + location.SectorOffset/4
+			location.Field = fmt.Sprintf("DIFAT[%v]", index)
+		}
+	case SectorFat:
+		location.Field = fmt.Sprintf("FAT[%v]", offset/4)
+	case SectorMinifat:
+		location.Field = fmt.Sprintf("MiniFAT[%v]", offset/4)
+	case SectorDirectory:
+		location.DirEntryId = uint32(offset / uint64(DIR_ENTRY_LEN))
+		location.Field = dirEntryField(offset % uint64(DIR_ENTRY_LEN))
+	case SectorMiniStream:
+		c.locateInMiniStream(location, layout, offset)
+	case SectorStreamData:
+		location.StreamId = claim.StreamId
+		location.Path = claim.Path
+		location.StreamOffset = offset
+		location.Slack = offset >= c.Directory.DirEntries[claim.StreamId].StreamSize
+	}
+
+	return location, nil
+}
+
+func (c *CompoundFile) locateInMiniStream(location *Location, layout *layout, miniStreamOffset uint64) {
+	miniSectorLen := uint64(c.MiniAlloc.MiniSectorLen)
+	location.MiniSectorId = uint32(miniStreamOffset / miniSectorLen)
+
+	if miniStreamOffset >= c.Directory.RootDirEntry().StreamSize {
+		location.StreamId = ROOT_STREAM_ID
+		location.Path = "/"
+		location.StreamOffset = miniStreamOffset
+		location.Slack = true
+		return
+	}
+
+	owner := layout.miniOwners[location.MiniSectorId]
+	if owner == nil {
+		return
+	}
+
+	location.StreamId = owner.streamId
+	location.Path = owner.path
+	location.StreamOffset = owner.offset + miniStreamOffset%miniSectorLen
+	location.Slack = location.StreamOffset >= c.Directory.DirEntries[owner.streamId].StreamSize
+}
+
+func (c *CompoundFile) getLayout() (*layout, error) {
+	c.layoutOnce.Do(func() {
+		rootEntry := c.Directory.RootDirEntry()
+		rootChain, _ := followChain(c.Directory.Allocator.fatTable(), rootEntry.StartingSector, c.Directory.Allocator.Sectors.NumSectors, 0)
+		miniSectorLen := uint64(c.MiniAlloc.MiniSectorLen)
+		numMiniSectors := uint32(uint64(len(rootChain)*c.Directory.Allocator.Sectors.SectorLen()) / miniSectorLen)
+
+		miniOwners := make([]*miniOwner, numMiniSectors)
+		entries := c.Walk()
+		for entry := entries.Next(); entry != nil; entry = entries.Next() {
+			dirEntry := c.Directory.DirEntries[entry.StreamId]
+			if !entry.IsStream() || entry.StreamLen == 0 || !c.isMiniStream(dirEntry) {
+				continue
+			}
+
+			sectorIds, _ := followChain(sliceTable(c.MiniAlloc.Minifat), dirEntry.StartingSector, numMiniSectors, 0)
+			for i, sectorId := range sectorIds {
+				if miniOwners[sectorId] == nil {
+					miniOwners[sectorId] = &miniOwner{
+						streamId: entry.StreamId,
+						path:     entry.Path,
+						offset:   uint64(i) * miniSectorLen,
+					}
+				}
+			}
+		}
+
+		if err := entries.Err(); err != nil {
+			c.layoutErr = err
+			return
+		}
+
+		sectorMap, err := c.SectorMap()
+		if err != nil {
+			c.layoutErr = err
+			return
+		}
+
+		c.layout = &layout{
+			sectorMap:  sectorMap,
+			miniOwners: miniOwners,
+		}
+	})
+
+	return c.layout, c.layoutErr
+}
+
+// Names the header field at an offset within the header.
+func headerField(offset int64) string {
+	switch {
+	case offset < 8:
+		return "MagicNumber"
+	case offset < 24:
+		return "CLSID"
+	case offset < 26:
+		return "MinorVersion"
+	case offset < 28:
+		return "Version"
+	case offset < 30:
+		return "ByteOrderMark"
+	case offset < 32:
+		return "SectorShift"
+	case offset < 34:
+		return "MiniSectorShift"
+	case offset < 40:
+		return "Reserved"
+	case offset < 44:
+		return "NumDirSectors"
+	case offset < 48:
+		return "NumFatSectors"
+	case offset < 52:
+		return "FirstDirSector"
+	case offset < 56:
+		return "TransactionSign"
+	case offset < 60:
+		return "MiniStreamCutoff"
+	case offset < 64:
+		return "FirstMinifatSector"
+	case offset < 68:
+		return "NumMinifatSector"
+	case offset < 72:
+		return "FirstDifatSector"
+	case offset < 76:
+		return "NumDifatSectors"
+	case offset < int64(HEADER_LEN):
+		return fmt.Sprintf("InitialDifatEntries[%v]", (offset-76)/4)
+	default:
+		return "padding"
+	}
+}
+
+// Names the directory entry field at an offset within the entry.
+func dirEntryField(offset uint64) string {
+	switch {
+	case offset < 64:
+		return "Name"
+	case offset < 66:
+		return "NameLength"
+	case offset < 67:
+		return "ObjType"
+	case offset < 68:
+		return "Color"
+	case offset < 72:
+		return "LeftSibling"
+	case offset < 76:
+		return "RightSibling"
+	case offset < 80:
+		return "Child"
+	case offset < 96:
+		return "CLSID"
+	case offset < 100:
+		return "StateBits"
+	case offset < 108:
+		return "CreationTime"
+	case offset < 116:
+		return "ModifiedTime"
+	case offset < 120:
+		return "StartingSector"
+	default:
+		return "StreamSize"
+	}
+}
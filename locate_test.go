@@ -0,0 +1,134 @@
+package mscfb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestLocate(t *testing.T) {
+	img := testFile{
+		version: V3,
+		entries: []testEntry{
+			{path: "/small", data: testPattern(1, 100)},
+			{path: "/storage/large", data: testPattern(2, 5000)},
+		},
+	}.build(t)
+
+	cf, err := Open(bytes.NewReader(img.data), ValidationStrict)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	// Every byte of every stream maps back to the stream and offset.
+	for _, path := range []string{"/small", "/storage/large"} {
+		extents, err := cf.Extents(path)
+		if err != nil {
+			t.Fatalf("Extents(%v) error = %v", path, err)
+		}
+		for _, extent := range extents {
+			for i := uint64(0); i < extent.Length; i += 37 {
+				location, err := cf.Locate(extent.FileOffset + int64(i))
+				if err != nil {
+					t.Fatalf("Locate() error = %v", err)
+				}
+				if location.Path != path || location.StreamOffset != extent.StreamOffset+i || location.Slack {
+					t.Fatalf("Locate(%v) = %+v, want %v at %v", extent.FileOffset+int64(i), location, path, extent.StreamOffset+i)
+				}
+			}
+		}
+	}
+
+	large := cf.Directory.DirEntries[img.dirIds["/storage/large"]]
+	root := cf.Directory.RootDirEntry()
+	tests := []struct {
+		name   string
+		offset int64
+		want   Location
+	}{
+		{
+			name:   "header field",
+			offset: 30,
+			want:   Location{Role: SectorHeader, Field: "SectorShift", DirEntryId: NO_STREAM, StreamId: NO_STREAM},
+		},
+		{
+			name:   "header difat",
+			offset: 76 + 4*3,
+			want:   Location{Role: SectorHeader, Field: "InitialDifatEntries[3]", DirEntryId: NO_STREAM, StreamId: NO_STREAM},
+		},
+		{
+			name:   "directory entry field",
+			offset: int64(img.sectorOffset(img.dirStart) + 2*DIR_ENTRY_LEN + 116),
+			want:   Location{Role: SectorDirectory, Field: "StartingSector", DirEntryId: 2, StreamId: NO_STREAM},
+		},
+		{
+			name:   "fat entry",
+			offset: int64(img.sectorOffset(img.fatStart) + 4*7),
+			want:   Location{Role: SectorFat, Field: "FAT[7]", DirEntryId: NO_STREAM, StreamId: NO_STREAM},
+		},
+		{
+			name:   "stream slack",
+			offset: int64(img.sectorOffset(large.StartingSector+9) + 5000 - 9*512),
+			want:   Location{Role: SectorStreamData, DirEntryId: NO_STREAM, StreamId: img.dirIds["/storage/large"], Path: "/storage/large", StreamOffset: 5000, Slack: true},
+		},
+		{
+			name:   "mini stream slack",
+			offset: int64(img.sectorOffset(root.StartingSector) + 200),
+			want:   Location{Role: SectorMiniStream, DirEntryId: NO_STREAM, StreamId: ROOT_STREAM_ID, Path: "/", StreamOffset: 200, MiniSectorId: 3, Slack: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cf.Locate(tt.offset)
+			if err != nil {
+				t.Fatalf("Locate() error = %v", err)
+			}
+			want := tt.want
+			want.FileOffset = got.FileOffset
+			want.SectorId = got.SectorId
+			want.SectorOffset = got.SectorOffset
+			if *got != want {
+				t.Errorf("Locate() = %+v, want %+v", *got, want)
+			}
+		})
+	}
+
+	if _, err := cf.Locate(int64(len(img.data))); err == nil {
+		t.Errorf("Locate() past the end of the file succeeded")
+	}
+}
+
+// In a truncated file, FAT sectors past the end of the file still count
+// towards the index of the FAT entries in the ones that follow.
+func TestLocateTruncated(t *testing.T) {
+	img := testFile{
+		version: V3,
+		entries: []testEntry{{path: "/large", data: testPattern(1, 70000)}},
+	}.build(t)
+
+	// Swap the two FAT sectors, which are the last two of the file, and cut
+	// off the last one, holding FAT[0] to FAT[127].
+	first, second := img.sectorOffset(img.fatStart), img.sectorOffset(img.fatStart+1)
+	if second+img.sectorLen != len(img.data) {
+		t.Fatalf("FAT sectors aren't last")
+	}
+	sector := append([]byte(nil), img.data[first:second]...)
+	copy(img.data[first:], img.data[second:])
+	copy(img.data[second:], sector)
+	binary.LittleEndian.PutUint32(img.data[76:], img.fatStart+1)
+	binary.LittleEndian.PutUint32(img.data[80:], img.fatStart)
+	truncated := img.data[:second]
+
+	cf, err := OpenWithOptions(bytes.NewReader(truncated), OpenOptions{Recover: true})
+	if err != nil {
+		t.Fatalf("OpenWithOptions() error = %v", err)
+	}
+
+	location, err := cf.Locate(int64(first + 4*7))
+	if err != nil {
+		t.Fatalf("Locate() error = %v", err)
+	}
+	if location.Role != SectorFat || location.Field != "FAT[135]" {
+		t.Errorf("Locate() = %v %v, want FAT FAT[135]", location.Role, location.Field)
+	}
+}
@@ -0,0 +1,64 @@
+package mscfb
+
+import "container/list"
+
+// lru is a least recently used cache bounded by the total cost of its
+// values, e.g. their count or their size in bytes.
+type lru struct {
+	capacity int64
+	used     int64
+	order    *list.List
+	items    map[uint64]*list.Element
+}
+
+type lruItem struct {
+	key   uint64
+	value interface{}
+	cost  int64
+}
+
+func newLRU(capacity int64) *lru {
+	return &lru{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[uint64]*list.Element),
+	}
+}
+
+func (c *lru) get(key uint64) (interface{}, bool) {
+	element, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	return element.Value.(*lruItem).value, true
+}
+
+// Adds a value, evicting the least recently used ones until the cache is
+// within its capacity. A value costing more than the capacity isn't kept.
+func (c *lru) add(key uint64, value interface{}, cost int64) {
+	if element, ok := c.items[key]; ok {
+		c.used -= element.Value.(*lruItem).cost
+		c.order.Remove(element)
+		delete(c.items, key)
+	}
+	if cost > c.capacity {
+		return
+	}
+
+	for c.used+cost > c.capacity {
+		oldest := c.order.Back()
+		item := oldest.Value.(*lruItem)
+		c.used -= item.cost
+		c.order.Remove(oldest)
+		delete(c.items, item.key)
+	}
+
+	c.items[key] = c.order.PushFront(&lruItem{key: key, value: value, cost: cost})
+	c.used += cost
+}
+
+func (c *lru) len() int {
+	return c.order.Len()
+}
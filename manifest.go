@@ -0,0 +1,121 @@
+package mscfb
+
+import (
+	"context"
+	"crypto"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Manifest lists every storage and stream of a compound file. Its JSON
+// encoding is stable: entries are in walk order, fields in declaration order
+// and digests keyed by algorithm name, so two manifests of the same file
+// encode to the same bytes.
+type Manifest struct {
+	Entries []*ManifestEntry `json:"entries"`
+}
+
+type ManifestEntry struct {
+	Path    string `json:"path"`
+	ObjType string `json:"type"`
+	Size    uint64 `json:"size"`
+	// Timestamps are RFC 3339 in UTC, and left empty if not set.
+	Created   string `json:"created,omitempty"`
+	Modified  string `json:"modified,omitempty"`
+	CLSID     string `json:"clsid,omitempty"`
+	StateBits uint32 `json:"stateBits,omitempty"`
+	// Digests holds the hex encoded digest of a stream's content for each
+	// requested hash, keyed by the hash's name, e.g. "SHA-256".
+	Digests map[string]string `json:"digests,omitempty"`
+}
+
+// Walks every storage and stream, returning their paths, sizes, timestamps
+// and CLSIDs along with digests of each stream's content. The package
+// doesn't link any hash functions in for this; the caller registers the
+// ones it asks for by importing their packages, e.g. crypto/sha256, and
+// Manifest fails for hashes that aren't available.
+func (c *CompoundFile) Manifest(hashes ...crypto.Hash) (*Manifest, error) {
+	return c.ManifestContext(context.Background(), hashes...)
+}
+
+// Like Manifest, but gives up with ctx's error if ctx is cancelled.
+func (c *CompoundFile) ManifestContext(ctx context.Context, hashes ...crypto.Hash) (*Manifest, error) {
+	if err := c.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	for _, h := range hashes {
+		if !h.Available() {
+			return nil, fmt.Errorf("hash function %v is not available", h)
+		}
+	}
+
+	manifest := &Manifest{Entries: make([]*ManifestEntry, 0)}
+	entries := c.WalkContext(ctx)
+	for entry := entries.Next(); entry != nil; entry = entries.Next() {
+		manifestEntry := &ManifestEntry{
+			Path:      entry.Path,
+			ObjType:   entry.ObjType.String(),
+			Size:      entry.StreamLen,
+			Created:   formatManifestTime(entry.Created()),
+			Modified:  formatManifestTime(entry.Modified()),
+			StateBits: entry.StateBits,
+		}
+		if entry.CLSID != uuid.Nil {
+			manifestEntry.CLSID = entry.CLSID.String()
+		}
+		if !entry.IsStream() {
+			manifestEntry.Size = 0
+		}
+
+		if entry.IsStream() && len(hashes) > 0 {
+			digests, err := c.streamDigests(ctx, entry, hashes)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %w", entry.Path, err)
+			}
+			manifestEntry.Digests = digests
+		}
+
+		manifest.Entries = append(manifest.Entries, manifestEntry)
+	}
+	if err := entries.Err(); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// Hashes a stream with all the hashes in a single pass.
+func (c *CompoundFile) streamDigests(ctx context.Context, entry *Entry, hashes []crypto.Hash) (map[string]string, error) {
+	hashers := make([]hash.Hash, len(hashes))
+	writers := make([]io.Writer, len(hashes))
+	for i, h := range hashes {
+		hashers[i] = h.New()
+		writers[i] = hashers[i]
+	}
+
+	_, err := newStream(c, entry.StreamId).WriteToContext(ctx, io.MultiWriter(writers...))
+	if err != nil {
+		return nil, err
+	}
+
+	digests := make(map[string]string, len(hashes))
+	for i, h := range hashes {
+		digests[h.String()] = hex.EncodeToString(hashers[i].Sum(nil))
+	}
+
+	return digests, nil
+}
+
+func formatManifestTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339Nano)
+}
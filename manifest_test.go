@@ -0,0 +1,95 @@
+package mscfb
+
+import (
+	"bytes"
+	"crypto"
+	_ "crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestManifest(t *testing.T) {
+	entries := []testEntry{
+		{path: "/small", data: testPattern(1, 100)},
+		{path: "/storage/large", data: testPattern(2, 5000)},
+	}
+	img := testFile{entries: entries}.build(t)
+	cf, err := Open(bytes.NewReader(img.data), ValidationStrict)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	modified := time.Date(2020, 5, 17, 12, 30, 0, 0, time.UTC)
+	cf.Directory.DirEntries[img.dirIds["/storage"]].ModifiedTime = FiletimeFromTime(modified)
+
+	manifest, err := cf.Manifest(crypto.SHA256, crypto.MD5)
+	if err != nil {
+		t.Fatalf("Manifest() error = %v", err)
+	}
+
+	byPath := make(map[string]*ManifestEntry)
+	for _, entry := range manifest.Entries {
+		byPath[entry.Path] = entry
+	}
+	if len(byPath) != 4 {
+		t.Fatalf("Manifest() has %v entries, want 4", len(byPath))
+	}
+
+	for _, e := range entries {
+		entry := byPath[e.path]
+		if entry == nil {
+			t.Fatalf("Manifest() is missing %v", e.path)
+		}
+		sum := sha256.Sum256(e.data)
+		if entry.Size != uint64(len(e.data)) || entry.Digests["SHA-256"] != hex.EncodeToString(sum[:]) || len(entry.Digests["MD5"]) != 32 {
+			t.Errorf("Manifest() entry = %+v", entry)
+		}
+	}
+	if got := byPath["/storage"].Modified; got != "2020-05-17T12:30:00Z" {
+		t.Errorf("Manifest() modified time = %q, want 2020-05-17T12:30:00Z", got)
+	}
+
+	first, _ := json.Marshal(manifest)
+	again, err := cf.Manifest(crypto.MD5, crypto.SHA256)
+	if err != nil {
+		t.Fatalf("Manifest() error = %v", err)
+	}
+	second, _ := json.Marshal(again)
+	if !bytes.Equal(first, second) {
+		t.Errorf("Manifest() encodes differently:\n%s\n%s", first, second)
+	}
+
+	// Hashes the caller hasn't linked in aren't available.
+	if _, err := cf.Manifest(crypto.MD4); err == nil {
+		t.Errorf("Manifest(MD4) error = nil, want MD4 unavailable")
+	}
+}
+
+func TestFiletime(t *testing.T) {
+	tests := []struct {
+		name     string
+		filetime uint64
+		time     time.Time
+	}{
+		{"unset", 0, time.Time{}},
+		{"unix epoch", 116444736000000000, time.Unix(0, 0).UTC()},
+		{"before unix epoch", 116444736000000000 - 15, time.Unix(0, -1500).UTC()},
+		{"sub-second", 132341922123456700, time.Date(2020, 5, 17, 12, 30, 12, 345670000, time.UTC)},
+		{"beyond int64 intervals", math.MaxUint64, time.Unix(1844674407370-11644473600, 955161500).UTC()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TimeFromFiletime(tt.filetime); !got.Equal(tt.time) {
+				t.Errorf("TimeFromFiletime() = %v, want %v", got, tt.time)
+			}
+			if got := FiletimeFromTime(tt.time); got != tt.filetime {
+				t.Errorf("FiletimeFromTime() = %v, want %v", got, tt.filetime)
+			}
+		})
+	}
+}
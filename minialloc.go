@@ -1,18 +1,28 @@
 package mscfb
 
-import "fmt"
+import (
+	"fmt"
+	"sync"
+)
 
 type MiniAlloc struct {
 	Directory          *Directory
 	Minifat            []uint32
 	MinifatStartSector uint32
+	MiniSectorLen      int
+
+	// The chain of sectors holding the mini stream, resolved on first use.
+	miniStreamOnce sync.Once
+	miniStream     *Chain
+	miniStreamErr  error
 }
 
-func NewMiniAlloc(d *Directory, minifat []uint32, minifatStartSector uint32) (*MiniAlloc, error) {
-	alloc := MiniAlloc{
+func NewMiniAlloc(d *Directory, minifat []uint32, minifatStartSector uint32, miniSectorLen int) (*MiniAlloc, error) {
+	alloc := &MiniAlloc{
 		Directory:          d,
 		Minifat:            minifat,
 		MinifatStartSector: minifatStartSector,
+		MiniSectorLen:      miniSectorLen,
 	}
 
 	err := alloc.Validate()
@@ -20,12 +30,12 @@ func NewMiniAlloc(d *Directory, minifat []uint32, minifatStartSector uint32) (*M
 		return nil, err
 	}
 
-	return &alloc, nil
+	return alloc, nil
 }
 
 func (a *MiniAlloc) Validate() error {
 	rootEntry := a.Directory.RootDirEntry()
-	rootStreamMiniSectors := rootEntry.StreamSize / uint64(MINI_SECTOR_LEN)
+	rootStreamMiniSectors := rootEntry.StreamSize / uint64(a.MiniSectorLen)
 	if rootStreamMiniSectors < uint64(len(a.Minifat)) {
 		return fmt.Errorf("miniFAT has %v entries, but root stream has only %v mini sectors",
 			len(a.Minifat), rootStreamMiniSectors)
@@ -78,11 +88,21 @@ func (a *MiniAlloc) Next(sectorId uint32) (uint32, error) {
 }
 
 func (a *MiniAlloc) SeekWithinMiniSector(sectorId uint32, offset uint64) (*Sector, error) {
-	miniStreamStartSector := a.Directory.RootDirEntry().StartingSector
-	chain, err := a.Directory.Allocator.OpenChain(miniStreamStartSector, SectorInitFat)
+	chain, err := a.miniStreamChain()
 	if err != nil {
 		return nil, err
 	}
 
-	return chain.IntoSubSector(sectorId, int64(MINI_SECTOR_LEN), offset)
+	return chain.IntoSubSector(sectorId, int64(a.MiniSectorLen), offset)
+}
+
+// Returns the chain holding the mini stream. It is followed once and then
+// shared by every read from a mini sector.
+func (a *MiniAlloc) miniStreamChain() (*Chain, error) {
+	a.miniStreamOnce.Do(func() {
+		miniStreamStartSector := a.Directory.RootDirEntry().StartingSector
+		a.miniStream, a.miniStreamErr = a.Directory.Allocator.OpenChain(miniStreamStartSector, SectorInitFat)
+	})
+
+	return a.miniStream, a.miniStreamErr
 }
@@ -14,7 +14,10 @@ type MiniChain struct {
 func NewMiniChain(miniAlloc *MiniAlloc, sectorId uint32) (*MiniChain, error) {
 	sectorIds := make([]uint32, 0)
 	currentSectorId := sectorId
-	firstSectorId := sectorId
+
+	// Cycles are caught as in NewChain.
+	savedSectorId := sectorId
+	power, steps := 1, 0
 
 	var err error
 	for currentSectorId != END_OF_CHAIN {
@@ -24,9 +27,15 @@ func NewMiniChain(miniAlloc *MiniAlloc, sectorId uint32) (*MiniChain, error) {
 			return nil, err
 		}
 
-		if currentSectorId == firstSectorId {
+		if currentSectorId == savedSectorId {
 			return nil, fmt.Errorf("chain contained duplicate sector id %v", currentSectorId)
 		}
+		steps++
+		if steps == power {
+			savedSectorId = currentSectorId
+			power *= 2
+			steps = 0
+		}
 	}
 
 	return &MiniChain{
@@ -37,7 +46,7 @@ func NewMiniChain(miniAlloc *MiniAlloc, sectorId uint32) (*MiniChain, error) {
 }
 
 func (c *MiniChain) Len() uint64 {
-	return uint64(MINI_SECTOR_LEN * len(c.SectorIds))
+	return uint64(c.MiniAlloc.MiniSectorLen * len(c.SectorIds))
 }
 
 func (c *MiniChain) ReadAll(p []byte) (int, error) {
@@ -71,7 +80,7 @@ func (c *MiniChain) Read(p []byte) (n int, err error) {
 		return 0, io.EOF
 	}
 
-	sectorLen := uint64(MINI_SECTOR_LEN)
+	sectorLen := uint64(c.MiniAlloc.MiniSectorLen)
 	currentSectorIndex := uint32(c.Offset / sectorLen)
 	currentSectorId := c.SectorIds[currentSectorIndex]
 	offsetWithinSector := c.Offset % sectorLen
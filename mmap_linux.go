@@ -0,0 +1,25 @@
+//go:build linux
+// +build linux
+
+package mscfb
+
+import (
+	"os"
+	"syscall"
+)
+
+// Maps a file into memory read-only. The mapping is private, so it is never
+// written back, and stays valid after the file is closed, until unmap is
+// called.
+func mapFile(file *os.File, size int64) ([]byte, func() error, error) {
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_PRIVATE)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	unmap := func() error {
+		return syscall.Munmap(data)
+	}
+
+	return data, unmap, nil
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package mscfb
+
+import (
+	"errors"
+	"os"
+)
+
+var errMmapUnsupported = errors.New("memory mapping is not supported on this platform")
+
+// Memory mapping is only implemented for Linux; elsewhere OpenFile reads
+// through the file instead.
+func mapFile(file *os.File, size int64) ([]byte, func() error, error) {
+	return nil, nil, errMmapUnsupported
+}
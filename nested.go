@@ -0,0 +1,334 @@
+package mscfb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// NESTED_SEPARATOR joins the path of a stream holding an embedded compound
+// file to paths within it, as in "/ObjectPool/_123/Package#/WordDocument".
+const NESTED_SEPARATOR = "#"
+
+// DEFAULT_MAX_NESTED_DEPTH is the nesting depth used when
+// NestedOptions.MaxDepth isn't set.
+const DEFAULT_MAX_NESTED_DEPTH = 8
+
+type NestedOptions struct {
+	// MaxDepth is how many levels of embedded files are opened; a file
+	// embedded directly in the top-level one is at depth 1. Zero selects
+	// DEFAULT_MAX_NESTED_DEPTH.
+	MaxDepth int
+	// Options used to open the embedded files.
+	OpenOptions OpenOptions
+}
+
+func (o NestedOptions) maxDepth() int {
+	if o.MaxDepth <= 0 {
+		return DEFAULT_MAX_NESTED_DEPTH
+	}
+
+	return o.MaxDepth
+}
+
+// NestedEntry is an entry of the top-level file or of a compound file
+// embedded in one of its streams.
+type NestedEntry struct {
+	*Entry
+	// CompositePath is the path from the top-level file, with the paths of
+	// embedding streams joined by NESTED_SEPARATOR. Entry.Path is the path
+	// within the embedded file.
+	CompositePath string
+	// Depth is 0 for entries of the top-level file.
+	Depth int
+	// File is the compound file holding the entry. Embedded files are
+	// closed as described for Embedded.
+	File *CompoundFile
+	// Embedded is the compound file stored in the stream, if it holds one
+	// and it was opened. It is closed once the walk has moved past its
+	// entries, or by NestedEntries.Close.
+	Embedded *CompoundFile
+	// Err is set if the stream starts like a compound file but couldn't be
+	// opened as one.
+	Err error
+}
+
+type nestedLevel struct {
+	file    *CompoundFile
+	entries *Entries
+	prefix  string
+	depth   int
+}
+
+// NestedEntries iterates over the entries of a compound file and of the
+// compound files embedded in its streams, descending into each embedded file
+// right after the stream holding it.
+type NestedEntries struct {
+	options NestedOptions
+	stack   []*nestedLevel
+	err     error
+}
+
+// Returns an iterator over every entry in the file and, recursively, in
+// compound files embedded in its streams, up to the configured depth.
+func (c *CompoundFile) WalkNested(options NestedOptions) *NestedEntries {
+	return &NestedEntries{
+		options: options,
+		stack:   []*nestedLevel{{file: c, entries: c.Walk()}},
+	}
+}
+
+func (n *NestedEntries) Next() *NestedEntry {
+	for len(n.stack) > 0 {
+		level := n.stack[len(n.stack)-1]
+		entry := level.entries.Next()
+		if entry == nil {
+			if err := level.entries.Err(); err != nil {
+				n.err = err
+				n.Close()
+				return nil
+			}
+			n.stack = n.stack[:len(n.stack)-1]
+			if level.depth > 0 {
+				level.file.Close()
+			}
+			continue
+		}
+
+		nested := &NestedEntry{
+			Entry:         entry,
+			CompositePath: level.prefix + entry.Path,
+			Depth:         level.depth,
+			File:          level.file,
+		}
+
+		if entry.IsStream() && level.depth < n.options.maxDepth() {
+			embedded, err := level.file.openEmbedded(entry.StreamId, n.options.OpenOptions)
+			nested.Embedded, nested.Err = embedded, err
+			if embedded != nil {
+				n.stack = append(n.stack, &nestedLevel{
+					file:    embedded,
+					entries: embedded.Walk(),
+					prefix:  nested.CompositePath + NESTED_SEPARATOR,
+					depth:   level.depth + 1,
+				})
+			}
+		}
+
+		return nested
+	}
+
+	return nil
+}
+
+// Returns the error that ended the walk early, if any.
+func (n *NestedEntries) Err() error {
+	return n.err
+}
+
+// Ends the walk, closing the embedded compound files still open. Embedded
+// files the walk has moved past are already closed, so Close only needs to
+// be called when stopping before Next returns nil.
+func (n *NestedEntries) Close() error {
+	embedded := make([]*CompoundFile, 0, len(n.stack))
+	for _, level := range n.stack {
+		if level.depth > 0 {
+			embedded = append(embedded, level.file)
+		}
+	}
+	n.stack = nil
+
+	return closeEmbedded(embedded)
+}
+
+// Reports whether the stream starts with the compound file signature.
+func (s *Stream) IsCompoundFile() (bool, error) {
+	if err := s.checkOpen(); err != nil {
+		return false, err
+	}
+
+	return s.CompoundFile.isEmbedded(s.StreamId)
+}
+
+// Opens the compound file stored in the stream.
+func (s *Stream) OpenCompoundFile(options OpenOptions) (*CompoundFile, error) {
+	if err := s.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	reader, err := s.CompoundFile.embeddedReader(s.StreamId)
+	if err != nil {
+		return nil, err
+	}
+
+	return OpenWithOptions(reader, options)
+}
+
+// Opens the stream at a composite path such as
+// "/ObjectPool/_123/Package#/WordDocument", opening the embedded compound
+// files along the way. Where a name ends in NESTED_SEPARATOR, a literal
+// path in the current file takes precedence over descending into a stream.
+// Closing the stream closes the embedded files.
+func (c *CompoundFile) OpenNestedStream(compositePath string, options NestedOptions) (*Stream, error) {
+	if err := c.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	file := c
+	rest := compositePath
+	opened := make([]*CompoundFile, 0)
+	for depth := 0; depth < options.maxDepth(); depth++ {
+		if ok, _ := file.IsStream(rest); ok {
+			break
+		}
+
+		embedded, inner, err := file.openEmbeddedPrefix(rest, options.OpenOptions)
+		if err != nil {
+			closeEmbedded(opened)
+			return nil, err
+		}
+		if embedded == nil {
+			break
+		}
+		opened = append(opened, embedded)
+		file, rest = embedded, inner
+	}
+
+	stream, err := file.OpenStream(rest)
+	if err != nil {
+		closeEmbedded(opened)
+		return nil, err
+	}
+	stream.embedded = opened
+
+	return stream, nil
+}
+
+// Finds the first prefix of path ending at a NESTED_SEPARATOR that names a
+// stream holding a compound file, and opens it. Returns the rest of the path,
+// within the embedded file.
+func (c *CompoundFile) openEmbeddedPrefix(path string, options OpenOptions) (*CompoundFile, string, error) {
+	separator := NESTED_SEPARATOR + "/"
+	for offset := 0; ; {
+		i := strings.Index(path[offset:], separator)
+		if i < 0 {
+			return nil, "", nil
+		}
+		prefix := path[:offset+i]
+		offset += i + len(NESTED_SEPARATOR)
+
+		stream, err := c.OpenStream(prefix)
+		if err != nil {
+			continue
+		}
+
+		embedded, err := c.openEmbedded(stream.StreamId, options)
+		if err != nil {
+			return nil, "", fmt.Errorf("%v: %w", prefix, err)
+		}
+		if embedded != nil {
+			return embedded, path[offset:], nil
+		}
+	}
+}
+
+// Reports whether a stream is large enough to hold a compound file and
+// starts with its signature.
+func (c *CompoundFile) isEmbedded(streamId uint32) (bool, error) {
+	if c.Directory.DirEntries[streamId].StreamSize < uint64(HEADER_LEN) {
+		return false, nil
+	}
+
+	reader, err := c.embeddedReader(streamId)
+	if err != nil {
+		return false, err
+	}
+
+	magic := make([]byte, len(MAGIC_NUMBER))
+	_, err = reader.ReadAt(magic, 0)
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(magic, MAGIC_NUMBER), nil
+}
+
+// Opens the compound file embedded in a stream, returning nil without an
+// error if the stream doesn't hold one.
+func (c *CompoundFile) openEmbedded(streamId uint32, options OpenOptions) (*CompoundFile, error) {
+	ok, err := c.isEmbedded(streamId)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	reader, err := c.embeddedReader(streamId)
+	if err != nil {
+		return nil, err
+	}
+
+	return OpenWithOptions(reader, options)
+}
+
+// Returns a reader over a stream's bytes that reads them at any offset
+// straight from the sectors holding them, for opening a compound file
+// embedded in the stream.
+func (c *CompoundFile) embeddedReader(streamId uint32) (*io.SectionReader, error) {
+	extents, err := c.streamExtents(streamId)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := &extentReader{sectors: c.Directory.Allocator.Sectors, extents: extents}
+	return io.NewSectionReader(reader, 0, int64(c.Directory.DirEntries[streamId].StreamSize)), nil
+}
+
+// extentReader is an io.ReaderAt over the bytes of a stream, given its
+// physical extents.
+type extentReader struct {
+	sectors *Sectors
+	extents []*Extent
+}
+
+func (r *extentReader) ReadAt(p []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, fmt.Errorf("negative offset: %v", offset)
+	}
+
+	sectorLen := int64(r.sectors.SectorLen())
+	i := sort.Search(len(r.extents), func(i int) bool {
+		extent := r.extents[i]
+		return int64(extent.StreamOffset+extent.Length) > offset
+	})
+
+	total := 0
+	for total < len(p) {
+		if i >= len(r.extents) {
+			return total, io.EOF
+		}
+		extent := r.extents[i]
+		within := uint64(offset) + uint64(total) - extent.StreamOffset
+		if within >= extent.Length {
+			i++
+			continue
+		}
+
+		// Extents may span several sectors; read one sector at a time.
+		fileOffset := extent.FileOffset + int64(within)
+		sectorOffset := fileOffset % sectorLen
+		n := min(uint64(len(p)-total), min(extent.Length-within, uint64(sectorLen-sectorOffset)))
+
+		sector, err := r.sectors.SeekWithinSector(uint32(fileOffset/sectorLen-1), sectorOffset)
+		if err != nil {
+			return total, err
+		}
+		read, err := io.ReadFull(sector, p[total:total+int(n)])
+		total += read
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
@@ -0,0 +1,176 @@
+package mscfb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"reflect"
+	"testing"
+)
+
+func TestWalkNested(t *testing.T) {
+	inner := testFile{entries: []testEntry{
+		{path: "/WordDocument", data: testPattern(1, 300)},
+	}}.build(t)
+	middle := testFile{entries: []testEntry{
+		{path: "/Package", data: inner.data},
+	}}.build(t)
+	outer := testFile{entries: []testEntry{
+		{path: "/ObjectPool/_123/Package", data: middle.data},
+		{path: "/Plain", data: testPattern(2, 600)},
+	}}.build(t)
+
+	cf, err := Open(bytes.NewReader(outer.data), ValidationStrict)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		maxDepth int
+		want     []string
+	}{
+		{"default depth", 0, []string{
+			"/", "/Plain", "/ObjectPool", "/ObjectPool/_123", "/ObjectPool/_123/Package",
+			"/ObjectPool/_123/Package#/", "/ObjectPool/_123/Package#/Package",
+			"/ObjectPool/_123/Package#/Package#/", "/ObjectPool/_123/Package#/Package#/WordDocument",
+		}},
+		{"depth limit", 1, []string{
+			"/", "/Plain", "/ObjectPool", "/ObjectPool/_123", "/ObjectPool/_123/Package",
+			"/ObjectPool/_123/Package#/", "/ObjectPool/_123/Package#/Package",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make([]string, 0)
+			entries := cf.WalkNested(NestedOptions{MaxDepth: tt.maxDepth})
+			for entry := entries.Next(); entry != nil; entry = entries.Next() {
+				if entry.Err != nil {
+					t.Errorf("%v: error = %v", entry.CompositePath, entry.Err)
+				}
+				got = append(got, entry.CompositePath)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("WalkNested() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	stream, err := cf.OpenNestedStream("/ObjectPool/_123/Package#/Package#/WordDocument", NestedOptions{})
+	if err != nil {
+		t.Fatalf("OpenNestedStream() error = %v", err)
+	}
+	data, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if !bytes.Equal(data, testPattern(1, 300)) {
+		t.Errorf("OpenNestedStream() read %v bytes not matching the embedded stream", len(data))
+	}
+
+	_, err = cf.OpenNestedStream("/ObjectPool/_123/Package#/Package#/WordDocument", NestedOptions{MaxDepth: 1})
+	if err == nil {
+		t.Errorf("OpenNestedStream() past the depth limit succeeded")
+	}
+}
+
+func TestEmbeddedReader(t *testing.T) {
+	img := testFile{entries: []testEntry{
+		{path: "/small", data: testPattern(1, 1000)},
+		{path: "/large", data: testPattern(2, 9000)},
+	}}.build(t)
+
+	cf, err := Open(bytes.NewReader(img.data), ValidationStrict)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	for path, want := range map[string][]byte{"/small": testPattern(1, 1000), "/large": testPattern(2, 9000)} {
+		reader, err := cf.embeddedReader(img.dirIds[path])
+		if err != nil {
+			t.Fatalf("embeddedReader(%v) error = %v", path, err)
+		}
+
+		// Reads start and end mid-sector and span several sectors.
+		for _, offset := range []int{0, 60, 300, len(want) - 700} {
+			buf := make([]byte, 650)
+			n, err := reader.ReadAt(buf, int64(offset))
+			if err != nil || n != len(buf) || !bytes.Equal(buf, want[offset:offset+n]) {
+				t.Errorf("%v: ReadAt(%v) = %v, %v, not matching the stream", path, offset, n, err)
+			}
+		}
+
+		buf := make([]byte, 100)
+		if n, err := reader.ReadAt(buf, int64(len(want)-50)); n != 50 || err != io.EOF {
+			t.Errorf("%v: ReadAt() past the end = %v, %v, want 50, EOF", path, n, err)
+		}
+	}
+}
+
+// Embedded files are closed once the walk, or the stream opened through
+// them, is done with them.
+func TestNestedClose(t *testing.T) {
+	inner := testFile{entries: []testEntry{
+		{path: "/WordDocument", data: testPattern(1, 300)},
+	}}.build(t)
+	outer := testFile{entries: []testEntry{
+		{path: "/Package", data: inner.data},
+		{path: "/Plain", data: testPattern(2, 600)},
+	}}.build(t)
+
+	cf, err := Open(bytes.NewReader(outer.data), ValidationStrict)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	var embedded *CompoundFile
+	entries := cf.WalkNested(NestedOptions{})
+	for entry := entries.Next(); entry != nil; entry = entries.Next() {
+		if entry.Embedded != nil {
+			embedded = entry.Embedded
+		}
+	}
+	if embedded == nil {
+		t.Fatalf("WalkNested() didn't open the embedded file")
+	}
+	if err := embedded.checkOpen(); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("embedded file after the walk: %v, want %v", err, fs.ErrClosed)
+	}
+
+	// Stopping early leaves it to Close.
+	entries = cf.WalkNested(NestedOptions{})
+	for entry := entries.Next(); entry != nil; entry = entries.Next() {
+		if entry.Embedded != nil {
+			embedded = entry.Embedded
+			break
+		}
+	}
+	if err := embedded.checkOpen(); err != nil {
+		t.Errorf("embedded file during the walk: %v", err)
+	}
+	if err := entries.Close(); err != nil {
+		t.Fatalf("NestedEntries.Close() error = %v", err)
+	}
+	if err := embedded.checkOpen(); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("embedded file after NestedEntries.Close(): %v, want %v", err, fs.ErrClosed)
+	}
+
+	stream, err := cf.OpenNestedStream("/Package#/WordDocument", NestedOptions{})
+	if err != nil {
+		t.Fatalf("OpenNestedStream() error = %v", err)
+	}
+	if len(stream.embedded) != 1 {
+		t.Fatalf("OpenNestedStream() opened %v embedded files, want 1", len(stream.embedded))
+	}
+	if err := stream.Close(); err != nil {
+		t.Fatalf("Stream.Close() error = %v", err)
+	}
+	if err := stream.embedded[0].checkOpen(); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("embedded file after Stream.Close(): %v, want %v", err, fs.ErrClosed)
+	}
+	if err := cf.checkOpen(); err != nil {
+		t.Errorf("top-level file after Stream.Close(): %v", err)
+	}
+}
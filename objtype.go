@@ -38,3 +38,18 @@ func ObjectFromByte(b byte) ObjectType {
 		return -1
 	}
 }
+
+func (o ObjectType) String() string {
+	switch o {
+	case ObjUnallocated:
+		return "unallocated"
+	case ObjStorage:
+		return "storage"
+	case ObjStream:
+		return "stream"
+	case ObjRoot:
+		return "root"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,216 @@
+package mscfb
+
+import (
+	"fmt"
+	"unicode/utf16"
+)
+
+// OrphanedEntry is a directory entry slot that isn't reachable from the root
+// storage, such as the remains of a deleted stream, along with whatever
+// data could still be recovered by following its starting sector.
+type OrphanedEntry struct {
+	ID       uint32
+	DirEntry *DirEntry
+	// RawObjType is the object type byte found on disk; DirEntry.ObjType is
+	// -1 if it isn't a known type.
+	RawObjType uint8
+	Data       []byte
+	// Bridged reports that links freed along with the entry were bridged by
+	// assuming its sectors were allocated one after another, so Data is a
+	// best guess.
+	Bridged bool
+	// Err explains why Data is shorter than DirEntry.StreamSize, if it is.
+	Err error
+}
+
+// Decodes every slot of the directory chain that isn't reachable from the
+// root entry and isn't blank, without validating it, and attempts to recover
+// its stream data through the FAT or MiniFAT.
+func (c *CompoundFile) OrphanedEntries() ([]*OrphanedEntry, error) {
+	if err := c.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	chain, err := c.Directory.Allocator.OpenChain(c.Directory.DirStartSector, SectorInitDir)
+	if err != nil {
+		return nil, err
+	}
+
+	slots := make([]byte, chain.Len())
+	n, err := chain.ReadAll(slots)
+	if err != nil && err != ErrTruncated {
+		return nil, err
+	}
+	slots = slots[:n-n%DIR_ENTRY_LEN]
+
+	reachable := c.Directory.reachableIds()
+	orphans := make([]*OrphanedEntry, 0)
+
+	for offset := 0; offset < len(slots); offset += DIR_ENTRY_LEN {
+		id := uint32(offset / DIR_ENTRY_LEN)
+		if reachable[id] {
+			continue
+		}
+
+		slot := slots[offset : offset+DIR_ENTRY_LEN]
+		dirEntry := decodeDirEntrySlot(slot, c.Header.Version)
+		if dirEntry.Name == "" && dirEntry.StreamSize == 0 &&
+			dirEntry.CreationTime == 0 && dirEntry.ModifiedTime == 0 {
+			continue
+		}
+
+		orphan := &OrphanedEntry{
+			ID:         id,
+			DirEntry:   dirEntry,
+			RawObjType: slot[66],
+		}
+		if dirEntry.StreamSize > 0 {
+			orphan.Data, orphan.Bridged, orphan.Err = c.recoverOrphanData(dirEntry)
+		}
+
+		orphans = append(orphans, orphan)
+	}
+
+	return orphans, nil
+}
+
+// Returns the ids of the directory entries reachable from the root entry,
+// skipping over links that point outside the directory.
+func (d *Directory) reachableIds() map[uint32]bool {
+	reachable := make(map[uint32]bool)
+	stack := []uint32{ROOT_STREAM_ID}
+
+	for len(stack) > 0 {
+		dirEntryId := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if dirEntryId == NO_STREAM || dirEntryId >= uint32(len(d.DirEntries)) || reachable[dirEntryId] {
+			continue
+		}
+		reachable[dirEntryId] = true
+
+		dirEntry := d.DirEntries[dirEntryId]
+		stack = append(stack, dirEntry.LeftSibling, dirEntry.RightSibling, dirEntry.Child)
+	}
+
+	return reachable
+}
+
+// Decodes a 128-byte directory entry slot without any validation, for
+// entries that may be stale or partially overwritten. Unknown object types
+// and colors decode as -1.
+func decodeDirEntrySlot(slot []byte, version Version) *DirEntry {
+	raw := decodeRawDirEntry(slot)
+
+	nameLength := raw.nameLength / 2
+	if nameLength > 32 {
+		nameLength = 32
+	}
+	name := raw.name[:nameLength]
+	for i, c := range name {
+		if c == 0 {
+			name = name[:i]
+			break
+		}
+	}
+
+	return &DirEntry{
+		Name:           string(utf16.Decode(name)),
+		ObjType:        ObjectFromByte(raw.objType),
+		Color:          ColorFromByte(raw.color),
+		LeftSibling:    raw.leftSibling,
+		RightSibling:   raw.rightSibling,
+		Child:          raw.child,
+		CLSID:          raw.clsid,
+		StateBits:      raw.stateBits,
+		CreationTime:   raw.creationTime,
+		ModifiedTime:   raw.modifiedTime,
+		StartingSector: raw.startingSector,
+		StreamSize:     raw.streamSize & version.SectorLenMask(),
+	}
+}
+
+// Follows an orphaned entry's starting sector through the FAT or MiniFAT for
+// as long as the links remain plausible, and reads up to StreamSize bytes.
+// Deleting a stream usually frees its sectors, losing the links between
+// them; as writers mostly allocate sectors in order, a freed link is bridged
+// to the following sector if that one is free too, and bridged is set.
+func (c *CompoundFile) recoverOrphanData(dirEntry *DirEntry) ([]byte, bool, error) {
+	mini := c.isMiniStream(dirEntry)
+
+	var table allocTable
+	var limit uint32
+	var sectorLen int
+	if mini {
+		table = sliceTable(c.MiniAlloc.Minifat)
+		rootChain, err := c.MiniAlloc.miniStreamChain()
+		if err != nil {
+			return nil, false, err
+		}
+		sectorLen = c.MiniAlloc.MiniSectorLen
+		limit = uint32(rootChain.Len() / uint64(sectorLen))
+	} else {
+		table = c.Directory.Allocator.fatTable()
+		sectorLen = c.Directory.Allocator.Sectors.SectorLen()
+		limit = c.Directory.Allocator.Sectors.NumSectors
+	}
+	// Entries past the end of the table, which may have been trimmed, are
+	// free.
+	entry := func(sectorId uint32) (uint32, error) {
+		if sectorId >= table.Len() {
+			return FREE_SECTOR, nil
+		}
+		return table.Entry(sectorId)
+	}
+
+	needed := int((dirEntry.StreamSize + uint64(sectorLen) - 1) / uint64(sectorLen))
+	sectorIds := make([]uint32, 0)
+	seen := make(map[uint32]bool)
+	var bridged bool
+	var chainErr error
+
+	for current := dirEntry.StartingSector; ; {
+		if current > MAX_REGULAR_SECTOR || current >= limit || seen[current] {
+			chainErr = fmt.Errorf("chain of orphaned entry %v breaks at sector %v", dirEntry.Name, current)
+			break
+		}
+		seen[current] = true
+		sectorIds = append(sectorIds, current)
+		if len(sectorIds) == needed {
+			break
+		}
+
+		next, err := entry(current)
+		if err != nil {
+			chainErr = err
+			break
+		}
+		if next == FREE_SECTOR && current+1 < limit {
+			following, err := entry(current + 1)
+			if err != nil {
+				chainErr = err
+				break
+			}
+			if following == FREE_SECTOR {
+				next = current + 1
+				bridged = true
+			}
+		}
+		if next == END_OF_CHAIN {
+			chainErr = fmt.Errorf("chain of orphaned entry %v ends after %v sectors", dirEntry.Name, len(sectorIds))
+			break
+		}
+		current = next
+	}
+
+	data, err := c.readSectors(sectorIds, mini)
+	if err != nil {
+		return data, bridged, err
+	}
+
+	if uint64(len(data)) > dirEntry.StreamSize {
+		data = data[:dirEntry.StreamSize]
+	}
+
+	return data, bridged, chainErr
+}
@@ -0,0 +1,101 @@
+package mscfb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestOrphanedEntries(t *testing.T) {
+	entries := []testEntry{
+		{path: "/kept", data: testPattern(1, 300)},
+		{path: "/deleted small", data: testPattern(2, 200), orphan: true},
+		{path: "/deleted large", data: testPattern(3, 6000), orphan: true},
+	}
+	img := testFile{version: V3, entries: entries}.build(t)
+
+	cf, err := Open(bytes.NewReader(img.data), ValidationPermissive)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	orphans, err := cf.OrphanedEntries()
+	if err != nil {
+		t.Fatalf("OrphanedEntries() error = %v", err)
+	}
+	if len(orphans) != 2 {
+		t.Fatalf("OrphanedEntries() returned %v entries, want 2", len(orphans))
+	}
+
+	for i, orphan := range orphans {
+		want := entries[i+1]
+		if orphan.ID != img.dirIds[want.path] {
+			t.Errorf("orphan %v: ID = %v, want %v", i, orphan.ID, img.dirIds[want.path])
+		}
+		if "/"+orphan.DirEntry.Name != want.path {
+			t.Errorf("orphan %v: Name = %q", i, orphan.DirEntry.Name)
+		}
+		if orphan.DirEntry.ObjType != ObjUnallocated || orphan.RawObjType != OBJ_TYPE_UNALLOCATED {
+			t.Errorf("orphan %v: ObjType = %v", i, orphan.DirEntry.ObjType)
+		}
+		if orphan.Err != nil || orphan.Bridged {
+			t.Errorf("orphan %v: Err = %v, Bridged = %v", i, orphan.Err, orphan.Bridged)
+		}
+		if !bytes.Equal(orphan.Data, want.data) {
+			t.Errorf("orphan %v: recovered %v bytes, want %v", i, len(orphan.Data), len(want.data))
+		}
+	}
+}
+
+// Deleting a stream usually frees its chain too, so the links between its
+// sectors are gone and have to be bridged.
+func TestOrphanedEntriesFreedChain(t *testing.T) {
+	entries := []testEntry{
+		{path: "/kept", data: testPattern(1, 300)},
+		{path: "/deleted small", data: testPattern(2, 200), orphan: true},
+		{path: "/deleted large", data: testPattern(3, 6000), orphan: true},
+		{path: "/kept large", data: testPattern(4, 5000)},
+	}
+	img := testFile{version: V3, entries: entries}.build(t)
+
+	// Mark the deleted streams' sectors free in the FAT and MiniFAT.
+	le := binary.LittleEndian
+	free := func(table int, start uint32) {
+		for id := start; id != END_OF_CHAIN; {
+			offset := table + 4*int(id)
+			id = le.Uint32(img.data[offset:])
+			le.PutUint32(img.data[offset:], FREE_SECTOR)
+		}
+	}
+	for _, path := range []string{"/deleted small", "/deleted large"} {
+		slot := img.data[img.sectorOffset(img.dirStart)+int(img.dirIds[path])*DIR_ENTRY_LEN:]
+		start := le.Uint32(slot[116:])
+		if le.Uint64(slot[120:]) < uint64(MINI_STREAM_CUTOFF) {
+			free(img.sectorOffset(le.Uint32(img.data[60:])), start)
+		} else {
+			free(img.sectorOffset(img.fatStart), start)
+		}
+	}
+
+	cf, err := Open(bytes.NewReader(img.data), ValidationPermissive)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	orphans, err := cf.OrphanedEntries()
+	if err != nil {
+		t.Fatalf("OrphanedEntries() error = %v", err)
+	}
+	if len(orphans) != 2 {
+		t.Fatalf("OrphanedEntries() returned %v entries, want 2", len(orphans))
+	}
+
+	for i, orphan := range orphans {
+		want := entries[i+1]
+		if orphan.Err != nil || !orphan.Bridged {
+			t.Errorf("%v: Err = %v, Bridged = %v, want bridged", want.path, orphan.Err, orphan.Bridged)
+		}
+		if !bytes.Equal(orphan.Data, want.data) {
+			t.Errorf("%v: recovered %v bytes not matching the stream", want.path, len(orphan.Data))
+		}
+	}
+}
@@ -2,10 +2,11 @@ package mscfb
 
 import (
 	"fmt"
-	"path"
-	"sort"
+	"strconv"
 	"strings"
+	"unicode"
 	"unicode/utf16"
+	"unicode/utf8"
 )
 
 const MAX_NAME_LEN int = 31
@@ -26,52 +27,155 @@ func ValidateName(name string, nameUtf16 []uint16) error {
 	return nil
 }
 
+// Compares two directory entry names the way MS-CFB section 2.6.4 orders
+// them: a shorter name (in UTF-16 code units) is always less than a longer
+// one, and names of equal length are compared code unit by code unit after
+// uppercasing each unit with the simple Unicode case mapping.
 func CompareNames(nameLeft, nameRight string) Ordering {
-	nl := len(utf16.Encode([]rune(nameLeft)))
-	nr := len(utf16.Encode([]rune(nameRight)))
-
-	if nl == nr {
-		if strings.EqualFold(nameLeft, nameRight) {
-			return OrderEqual
-		} else {
-			sc := []string{nameLeft, nameRight}
-			sort.Strings(sc)
-			if sc[0] == nameLeft {
-				return OrderLess
-			}
+	left := utf16.Encode([]rune(nameLeft))
+	right := utf16.Encode([]rune(nameRight))
 
+	if len(left) != len(right) {
+		if len(left) > len(right) {
 			return OrderGreater
 		}
+
+		return OrderLess
 	}
 
-	if nl > nr {
-		return OrderGreater
+	for i := range left {
+		l := upperCodeUnit(left[i])
+		r := upperCodeUnit(right[i])
+		if l < r {
+			return OrderLess
+		}
+		if l > r {
+			return OrderGreater
+		}
 	}
 
-	return OrderLess
+	return OrderEqual
 }
 
-func NameChainFromPath(s string) []string {
-	s = path.Clean(s)
-	if s == "" {
-		return []string{}
+// Uppercases a single UTF-16 code unit. Surrogate halves, and code units
+// whose uppercase form would not fit in a single code unit, are returned
+// unchanged.
+func upperCodeUnit(c uint16) uint16 {
+	if utf16.IsSurrogate(rune(c)) {
+		return c
+	}
+
+	u := unicode.ToUpper(rune(c))
+	if u > 0xffff {
+		return c
+	}
+
+	return uint16(u)
+}
+
+// Escapes a single entry name so that it can be used as one component of a
+// path. Percent signs, slashes, control characters and leading or trailing
+// spaces are percent-encoded (as their UTF-8 bytes), the names "." and ".."
+// are encoded in full so they aren't mistaken for relative path elements,
+// and the empty name is encoded as a lone "%". UnescapeName reverses this.
+func EscapeName(name string) string {
+	switch name {
+	case "":
+		return "%"
+	case ".":
+		return "%2E"
+	case "..":
+		return "%2E%2E"
+	}
+
+	var b strings.Builder
+	for i, r := range name {
+		escape := r == '%' || r == '/' || unicode.IsControl(r) ||
+			(r == ' ' && (i == 0 || i == len(name)-1))
+		if !escape {
+			b.WriteRune(r)
+			continue
+		}
+
+		var buf [utf8.UTFMax]byte
+		n := utf8.EncodeRune(buf[:], r)
+		for _, c := range buf[:n] {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+// Decodes a path component produced by EscapeName back into the entry name.
+func UnescapeName(s string) (string, error) {
+	if s == "%" {
+		return "", nil
 	}
 
-	if s[0] == '/' {
-		s = s[1:]
+	if !strings.Contains(s, "%") {
+		return s, nil
 	}
 
-	if s == "" {
-		return []string{}
+	buf := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			buf = append(buf, s[i])
+			continue
+		}
+
+		if i+2 >= len(s) {
+			return "", fmt.Errorf("truncated escape sequence in name: %v", s)
+		}
+
+		c, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", fmt.Errorf("invalid escape sequence in name: %v", s)
+		}
+
+		buf = append(buf, byte(c))
+		i += 2
 	}
 
-	if strings.HasPrefix(s, "..") {
-		return []string{}
+	return string(buf), nil
+}
+
+// Splits a path into the chain of entry names it refers to. Components are
+// unescaped with UnescapeName; a component that isn't a valid escape is taken
+// literally. "." components are ignored and ".." removes the previous name;
+// a path that climbs above the root yields an empty chain.
+func NameChainFromPath(s string) []string {
+	names := []string{}
+
+	for _, part := range strings.Split(s, "/") {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if len(names) == 0 {
+				return []string{}
+			}
+			names = names[:len(names)-1]
+			continue
+		}
+
+		name, err := UnescapeName(part)
+		if err != nil {
+			name = part
+		}
+		names = append(names, name)
 	}
 
-	return strings.Split(s, "/")
+	return names
 }
 
+// Builds an absolute path from a chain of entry names, escaping each name
+// with EscapeName.
 func PathFromNameChain(names []string) string {
-	return "/" + strings.Join(names, "/")
+	escaped := make([]string, len(names))
+	for i, name := range names {
+		escaped[i] = EscapeName(name)
+	}
+
+	return "/" + strings.Join(escaped, "/")
 }
@@ -17,7 +17,12 @@ func TestNameChainFromPath(t *testing.T) {
 		{
 			name: "empty",
 			args: args{s: ""},
-			want: []string{"."},
+			want: []string{},
+		},
+		{
+			name: "root",
+			args: args{s: "/"},
+			want: []string{},
 		},
 		{
 			name: "valid abs",
@@ -39,6 +44,26 @@ func TestNameChainFromPath(t *testing.T) {
 			args: args{s: "foo/../../baz"},
 			want: []string{},
 		},
+		{
+			name: "escaped dots",
+			args: args{s: "/%2E/%2E%2E/baz"},
+			want: []string{".", "..", "baz"},
+		},
+		{
+			name: "escaped ole prefix",
+			args: args{s: "/%05SummaryInformation"},
+			want: []string{"\x05SummaryInformation"},
+		},
+		{
+			name: "empty name",
+			args: args{s: "/foo/%"},
+			want: []string{"foo", ""},
+		},
+		{
+			name: "invalid escape taken literally",
+			args: args{s: "/100%/50%zz"},
+			want: []string{"100%", "50%zz"},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -68,6 +93,11 @@ func TestPathFromNameChain(t *testing.T) {
 			args: args{names: []string{"foo", "bar", "baz"}},
 			want: "/foo/bar/baz",
 		},
+		{
+			name: "special names",
+			args: args{names: []string{".", "..", "", " a b ", "1\x01%"}},
+			want: "/%2E/%2E%2E/%/%20a b%20/1%01%25",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -77,3 +107,163 @@ func TestPathFromNameChain(t *testing.T) {
 		})
 	}
 }
+
+func TestEscapeName(t *testing.T) {
+	names := []string{
+		"WordDocument",
+		"\x01CompObj",
+		"\x05DocumentSummaryInformation",
+		".",
+		"..",
+		"...",
+		"",
+		"%",
+		"%25",
+		" ",
+		"  leading",
+		"trailing  ",
+		"in ner",
+		"tab\tand\nnewline",
+		"del\x7f",
+		"c1\u0085control",
+		"привет",
+		"䡀㽿䅤",
+		"a/b",
+	}
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			escaped := EscapeName(name)
+			if escaped == "" || escaped == "." || escaped == ".." {
+				t.Fatalf("EscapeName(%q) = %q is not addressable", name, escaped)
+			}
+
+			got, err := UnescapeName(escaped)
+			if err != nil {
+				t.Fatalf("UnescapeName(%q) error = %v", escaped, err)
+			}
+			if got != name {
+				t.Errorf("UnescapeName(EscapeName(%q)) = %q", name, got)
+			}
+
+			chain := NameChainFromPath(PathFromNameChain([]string{"parent", name}))
+			if !reflect.DeepEqual(chain, []string{"parent", name}) {
+				t.Errorf("NameChainFromPath(PathFromNameChain()) = %q", chain)
+			}
+		})
+	}
+}
+
+func TestCompareNames(t *testing.T) {
+	type args struct {
+		left  string
+		right string
+	}
+	tests := []struct {
+		name string
+		args args
+		want Ordering
+	}{
+		{
+			name: "equal",
+			args: args{left: "WordDocument", right: "WordDocument"},
+			want: OrderEqual,
+		},
+		{
+			name: "ascii case insensitive",
+			args: args{left: "worddocument", right: "WORDDOCUMENT"},
+			want: OrderEqual,
+		},
+		{
+			name: "shorter is less",
+			args: args{left: "Zz", right: "aaa"},
+			want: OrderLess,
+		},
+		{
+			name: "longer is greater",
+			args: args{left: "aaa", right: "Zz"},
+			want: OrderGreater,
+		},
+		{
+			name: "uppercased code units",
+			args: args{left: "a_", right: "B_"},
+			want: OrderLess,
+		},
+		{
+			// '_' (0x5f) sorts after 'A' (0x41) once 'a' is uppercased, but
+			// before 'a' (0x61) if it weren't.
+			name: "underscore after uppercase letter",
+			args: args{left: "_", right: "a"},
+			want: OrderGreater,
+		},
+		{
+			name: "cyrillic case insensitive",
+			args: args{left: "привет", right: "ПРИВЕТ"},
+			want: OrderEqual,
+		},
+		{
+			name: "cyrillic ordering",
+			args: args{left: "а", right: "Б"},
+			want: OrderLess,
+		},
+		{
+			name: "turkish dotless i uppercases to I",
+			args: args{left: "ı", right: "I"},
+			want: OrderEqual,
+		},
+		{
+			name: "turkish dotted capital I has no simple mapping",
+			args: args{left: "İ", right: "i"},
+			want: OrderGreater,
+		},
+		{
+			name: "sharp s is not expanded",
+			args: args{left: "ß", right: "SS"},
+			want: OrderLess,
+		},
+		{
+			name: "micro sign uppercases to greek mu",
+			args: args{left: "µ", right: "Μ"},
+			want: OrderEqual,
+		},
+		{
+			name: "y diaeresis uppercases outside latin-1",
+			args: args{left: "ÿ", right: "Ā"},
+			want: OrderGreater,
+		},
+		{
+			// Two runes but four code units against three of each.
+			name: "length counts utf-16 code units, not runes",
+			args: args{left: "𝄞𝄞", right: "abc"},
+			want: OrderGreater,
+		},
+		{
+			// Four bytes of UTF-8 but two code units against three.
+			name: "length counts utf-16 code units, not bytes",
+			args: args{left: "éé", right: "abc"},
+			want: OrderLess,
+		},
+		{
+			// Same length, and the high surrogate 0xd834 sorts after 'A'.
+			name: "surrogate pairs compare by code unit",
+			args: args{left: "𝄞", right: "ab"},
+			want: OrderGreater,
+		},
+		{
+			name: "msi encoded stream names",
+			args: args{left: "䡀㽿䅤", right: "䡀㬿䕷"},
+			want: OrderGreater,
+		},
+		{
+			name: "ole prefixed names",
+			args: args{left: "\x01CompObj", right: "\x05SummaryInformation"},
+			want: OrderLess,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CompareNames(tt.args.left, tt.args.right); got != tt.want {
+				t.Errorf("CompareNames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
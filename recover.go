@@ -0,0 +1,111 @@
+package mscfb
+
+// StreamStatus reports how much of a stream is present in a possibly
+// truncated file.
+type StreamStatus struct {
+	StreamId  uint32
+	Path      string
+	NameChain []string
+	Size      uint64
+	// Number of bytes that can be read from the start of the stream before
+	// running into the end of the file.
+	Available uint64
+}
+
+func (s *StreamStatus) IsComplete() bool {
+	return s.Available >= s.Size
+}
+
+// Returns the status of every stream in the file. It's most useful for files
+// opened with OpenOptions.Recover, where some streams may be cut short.
+func (c *CompoundFile) StreamStatuses() ([]*StreamStatus, error) {
+	if err := c.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*StreamStatus, 0)
+
+	entries := c.Walk()
+	for entry := entries.Next(); entry != nil; entry = entries.Next() {
+		if !entry.IsStream() {
+			continue
+		}
+
+		available, err := c.availableStreamBytes(c.Directory.DirEntries[entry.StreamId])
+		if err != nil {
+			return nil, err
+		}
+
+		statuses = append(statuses, &StreamStatus{
+			StreamId:  entry.StreamId,
+			Path:      entry.Path,
+			NameChain: entry.NameChain,
+			Size:      entry.StreamLen,
+			Available: available,
+		})
+	}
+	if err := entries.Err(); err != nil {
+		return nil, err
+	}
+
+	return statuses, nil
+}
+
+// Counts the bytes of a stream that precede the first byte missing from the
+// file, following its chain through the sectors or mini sectors.
+func (c *CompoundFile) availableStreamBytes(dirEntry *DirEntry) (uint64, error) {
+	if dirEntry.StreamSize == 0 {
+		return 0, nil
+	}
+
+	sectors := c.Directory.Allocator.Sectors
+	var available uint64
+
+	if c.isMiniStream(dirEntry) {
+		miniChain, err := c.MiniAlloc.OpenMiniChain(dirEntry.StartingSector)
+		if err != nil {
+			return 0, err
+		}
+
+		rootChain, err := c.MiniAlloc.miniStreamChain()
+		if err != nil {
+			return 0, err
+		}
+
+		miniSectorLen := uint64(c.MiniAlloc.MiniSectorLen)
+		miniPerSector := uint64(sectors.SectorLen()) / miniSectorLen
+		for _, miniSectorId := range miniChain.SectorIds {
+			index := uint64(miniSectorId) / miniPerSector
+			if index >= uint64(len(rootChain.SectorIds)) {
+				break
+			}
+
+			start := (uint64(miniSectorId) % miniPerSector) * miniSectorLen
+			present := uint64(sectors.available(rootChain.SectorIds[index]))
+			if present <= start {
+				break
+			}
+
+			n := min(present-start, miniSectorLen)
+			available += n
+			if n < miniSectorLen {
+				break
+			}
+		}
+	} else {
+		chain, err := c.Directory.Allocator.OpenChain(dirEntry.StartingSector, SectorInitZero)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, sectorId := range chain.SectorIds {
+			n := uint64(sectors.available(sectorId))
+			available += n
+			if n < uint64(sectors.SectorLen()) {
+				break
+			}
+		}
+	}
+
+	return min(available, dirEntry.StreamSize), nil
+}
@@ -1,8 +1,11 @@
 package mscfb
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"io"
+	"sync"
 )
 
 type SectorInit int
@@ -19,32 +22,92 @@ func (s SectorInit) Initialize(sector *Sectors) {
 }
 
 type Sectors struct {
-	Version    Version
-	NumSectors uint32
+	Version     Version
+	SectorShift uint16
+	NumSectors  uint32
+	Length      int64
 
 	inner io.ReadSeeker
+	// innerAt is inner as an io.ReaderAt, if it is one, so that sectors can
+	// be read concurrently; otherwise reads are serialized by mu.
+	innerAt io.ReaderAt
+	mu      sync.Mutex
+	// data, if set, is the whole file mapped into memory, and cache, if
+	// set, keeps recently read sectors; either serves sectors from memory.
+	data  []byte
+	cache *sectorCache
 }
 
 type Sector struct {
 	SectorLen int64
 	Offset    int64
 
-	reader io.ReadSeeker
+	// reader holds the sector's bytes if they are in memory. Otherwise they
+	// are read from sectors, where the sector starts at file offset start.
+	reader  io.ReadSeeker
+	sectors *Sectors
+	start   int64
+	// Number of bytes of this sector, counted from its start, that are
+	// actually present in the underlying file.
+	available int64
 }
 
-func NewSectors(v Version, bufferLength int64, reader io.ReadSeeker) *Sectors {
-	sectorLen := v.SectorLen()
+func NewSectors(v Version, sectorShift uint16, bufferLength int64, reader io.ReadSeeker) *Sectors {
+	sectorLen := 1 << int(sectorShift)
 	numSectors := ((bufferLength + int64(sectorLen) - 1) / int64(sectorLen)) - 1
 
-	return &Sectors{
-		Version:    v,
-		NumSectors: uint32(numSectors),
-		inner:      reader,
+	sectors := &Sectors{
+		Version:     v,
+		SectorShift: sectorShift,
+		NumSectors:  uint32(numSectors),
+		Length:      bufferLength,
+		inner:       reader,
 	}
+	if readerAt, ok := reader.(io.ReaderAt); ok {
+		sectors.innerAt = readerAt
+	}
+
+	return sectors
+}
+
+// Reads len(p) bytes at a file offset. Safe for concurrent use.
+func (s *Sectors) readAt(p []byte, offset int64) (int, error) {
+	if s.innerAt != nil {
+		n, err := s.innerAt.ReadAt(p, offset)
+		if err == io.EOF && n == len(p) {
+			err = nil
+		}
+		return n, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.inner.Seek(offset, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+
+	return io.ReadFull(s.inner, p)
 }
 
 func (s *Sectors) SectorLen() int {
-	return s.Version.SectorLen()
+	return 1 << int(s.SectorShift)
+}
+
+// Reports whether the file ends before the last sector it addresses does.
+func (s *Sectors) Truncated() bool {
+	return (int64(s.NumSectors)+1)*int64(s.SectorLen()) > s.Length
+}
+
+// Returns the number of bytes of the given sector present in the file.
+func (s *Sectors) available(sectorId uint32) int64 {
+	start := int64(sectorId+1) * int64(s.SectorLen())
+	if start >= s.Length {
+		return 0
+	}
+
+	return int64(min(uint64(s.Length-start), uint64(s.SectorLen())))
 }
 
 func (s *Sectors) SeekToSector(sectorId uint32) (*Sector, error) {
@@ -56,23 +119,67 @@ func (s *Sectors) SeekWithinSector(sectorId uint32, offset int64) (*Sector, erro
 		return nil, fmt.Errorf("tried to seek to sector %v, but sector count is only %v", sectorId, s.NumSectors)
 	}
 
-	_, err := s.inner.Seek(int64(sectorId+1)*int64(s.SectorLen())+offset, io.SeekStart)
-	if err != nil {
-		return nil, err
+	if s.data != nil || s.cache != nil {
+		var data []byte
+		var err error
+		if s.data != nil {
+			data = s.mappedSector(sectorId)
+		} else {
+			data, err = s.cache.sector(s, sectorId)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		reader := bytes.NewReader(data)
+		_, err = reader.Seek(offset, io.SeekStart)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Sector{
+			SectorLen: int64(s.SectorLen()),
+			Offset:    offset,
+			reader:    reader,
+			available: int64(len(data)),
+		}, nil
 	}
 
 	return &Sector{
 		SectorLen: int64(s.SectorLen()),
 		Offset:    offset,
-		reader:    s.inner,
+		sectors:   s,
+		start:     int64(sectorId+1) * int64(s.SectorLen()),
+		available: s.available(sectorId),
 	}, nil
 }
 
+// Returns the bytes of a sector present in the mapped file, without copying
+// them.
+func (s *Sectors) mappedSector(sectorId uint32) []byte {
+	start := int64(sectorId+1) * int64(s.SectorLen())
+	if start > int64(len(s.data)) {
+		return s.data[len(s.data):]
+	}
+
+	return s.data[start : start+s.available(sectorId)]
+}
+
 func (s *Sector) SubSector(start, len int64) (*Sector, error) {
+	available := s.available - start
+	if available < 0 {
+		available = 0
+	} else if available > len {
+		available = len
+	}
+
 	return &Sector{
 		SectorLen: len,
 		Offset:    s.Offset - start,
 		reader:    s.reader,
+		sectors:   s.sectors,
+		start:     s.start + start,
+		available: available,
 	}, nil
 }
 
@@ -86,7 +193,18 @@ func (s *Sector) Read(p []byte) (int, error) {
 		return 0, io.EOF
 	}
 
-	bytesReaded, err := s.reader.Read(p[:maxLen])
+	if s.Offset >= s.available {
+		return 0, ErrTruncated
+	}
+	maxLen = min(maxLen, uint64(s.available-s.Offset))
+
+	var bytesReaded int
+	var err error
+	if s.reader != nil {
+		bytesReaded, err = s.reader.Read(p[:maxLen])
+	} else {
+		bytesReaded, err = s.sectors.readAt(p[:maxLen], s.start+s.Offset)
+	}
 	if err != nil {
 		return 0, err
 	}
@@ -94,3 +212,66 @@ func (s *Sector) Read(p []byte) (int, error) {
 	s.Offset += int64(bytesReaded)
 	return bytesReaded, nil
 }
+
+// Reads a whole (sub)sector into buf, which must be at least as long.
+func readFullSector(sector *Sector, buf []byte) (int, error) {
+	total := 0
+	for total < int(sector.SectorLen) {
+		n, err := sector.Read(buf[total:sector.SectorLen])
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
+
+// Reads a whole sector into buf, which must be at least a sector long.
+// Returns ErrTruncated, along with the bytes present, if the file ends
+// within the sector.
+func (s *Sectors) readSector(sectorId uint32, buf []byte) (int, error) {
+	sector, err := s.SeekToSector(sectorId)
+	if err != nil {
+		return 0, err
+	}
+
+	return readFullSector(sector, buf)
+}
+
+// Decodes buf as little-endian uint32 values, appending them to dst. A
+// trailing partial value is ignored.
+func appendUint32s(dst []uint32, buf []byte) []uint32 {
+	for i := 0; i+4 <= len(buf); i += 4 {
+		dst = append(dst, binary.LittleEndian.Uint32(buf[i:]))
+	}
+
+	return dst
+}
+
+// Returns n bytes of the file starting at offset, reading them into buf
+// unless the file is mapped. If the file ends first, the bytes present are
+// returned with ErrTruncated.
+func (s *Sectors) readRange(offset int64, n int, buf []byte) ([]byte, error) {
+	var err error
+	if offset+int64(n) > s.Length {
+		n = 0
+		if offset < s.Length {
+			n = int(s.Length - offset)
+		}
+		err = ErrTruncated
+	}
+
+	if s.data != nil {
+		return s.data[offset : offset+int64(n)], err
+	}
+
+	if n > 0 {
+		read, readErr := s.readAt(buf[:n], offset)
+		if readErr != nil {
+			return buf[:read], readErr
+		}
+	}
+
+	return buf[:n], err
+}
@@ -0,0 +1,164 @@
+package mscfb
+
+import "fmt"
+
+type SectorRole int
+
+const (
+	SectorUnreferenced SectorRole = iota
+	SectorDifat
+	SectorFat
+	SectorMinifat
+	SectorDirectory
+	SectorMiniStream
+	SectorStreamData
+	SectorFree
+	SectorBeyondFat
+	// Not a sector as such, but the file header in front of sector 0.
+	SectorHeader
+)
+
+func (r SectorRole) String() string {
+	switch r {
+	case SectorUnreferenced:
+		return "unreferenced"
+	case SectorDifat:
+		return "DIFAT"
+	case SectorFat:
+		return "FAT"
+	case SectorMinifat:
+		return "MiniFAT"
+	case SectorDirectory:
+		return "directory"
+	case SectorMiniStream:
+		return "mini stream"
+	case SectorStreamData:
+		return "stream data"
+	case SectorFree:
+		return "free"
+	case SectorBeyondFat:
+		return "beyond FAT"
+	case SectorHeader:
+		return "header"
+	default:
+		return "unknown"
+	}
+}
+
+// SectorClaim is one chain's claim on a sector.
+type SectorClaim struct {
+	Role SectorRole
+	// StreamId and Path identify the owning directory entry for stream data
+	// and the mini stream (owned by the root entry); StreamId is NO_STREAM
+	// for the other structures.
+	StreamId uint32
+	Path     string
+	// Offset of the sector's first byte within the stream or structure.
+	Offset uint64
+}
+
+// SectorMapEntry describes what a single sector is used for.
+type SectorMapEntry struct {
+	SectorId uint32
+	// Role is the role of the first claim, or, for unclaimed sectors, whether
+	// the FAT marks the sector free, doesn't cover it, or allocates it
+	// without any reachable chain using it.
+	Role   SectorRole
+	Claims []SectorClaim
+}
+
+// Reports whether more than one chain claims the sector.
+func (e *SectorMapEntry) IsOverlapping() bool {
+	return len(e.Claims) > 1
+}
+
+// Returns an entry for every sector in the file describing its role and
+// owner. Chains are followed leniently, so a broken chain claims the sectors
+// up to the break, and sectors claimed more than once are reported as
+// overlapping rather than as an error.
+func (c *CompoundFile) SectorMap() ([]*SectorMapEntry, error) {
+	if err := c.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	allocator := c.Directory.Allocator
+	sectorMap := make([]*SectorMapEntry, allocator.Sectors.NumSectors)
+	for i := range sectorMap {
+		sectorMap[i] = &SectorMapEntry{SectorId: uint32(i)}
+	}
+
+	sectorLen := uint64(allocator.Sectors.SectorLen())
+	err := c.visitClaimedChains(func(claim SectorClaim, sectorIds []uint32, _ error) {
+		for i, sectorId := range sectorIds {
+			if sectorId >= allocator.Sectors.NumSectors {
+				continue
+			}
+			claim.Offset = uint64(i) * sectorLen
+			sectorMap[sectorId].Claims = append(sectorMap[sectorId].Claims, claim)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range sectorMap {
+		switch {
+		case len(entry.Claims) > 0:
+			entry.Role = entry.Claims[0].Role
+		case entry.SectorId >= allocator.FatLen():
+			entry.Role = SectorBeyondFat
+		case isFreeSector(allocator, entry.SectorId):
+			entry.Role = SectorFree
+		default:
+			entry.Role = SectorUnreferenced
+		}
+	}
+
+	return sectorMap, nil
+}
+
+// Calls fn for every chain of regular sectors claimed by the DIFAT, FAT,
+// MiniFAT, directory, mini stream and each reachable stream at or above the
+// mini stream cutoff. The claim's Offset is left zero. If a chain breaks,
+// fn gets the sectors up to the break along with the error. The DIFAT and
+// FAT sectors are passed as listed, so a sector's index is its position in
+// the structure even if earlier ones lie past the end of the file; fn must
+// skip sector ids at or past NumSectors. The error returned is the one that
+// stopped the walk over the directory, if any.
+func (c *CompoundFile) visitClaimedChains(fn func(claim SectorClaim, sectorIds []uint32, err error)) error {
+	allocator := c.Directory.Allocator
+	numSectors := allocator.Sectors.NumSectors
+	follow := func(claim SectorClaim, name string, start uint32) {
+		sectorIds, err := followChain(allocator.fatTable(), start, numSectors, 0)
+		if err != nil {
+			err = fmt.Errorf("%v: %w", name, err)
+		}
+		fn(claim, sectorIds, err)
+	}
+
+	fn(SectorClaim{Role: SectorDifat, StreamId: NO_STREAM}, allocator.DifatSectorIds, nil)
+	fn(SectorClaim{Role: SectorFat, StreamId: NO_STREAM}, allocator.Difat, nil)
+
+	follow(SectorClaim{Role: SectorMinifat, StreamId: NO_STREAM}, "MiniFAT", c.MiniAlloc.MinifatStartSector)
+	follow(SectorClaim{Role: SectorDirectory, StreamId: NO_STREAM}, "directory", c.Directory.DirStartSector)
+	follow(SectorClaim{Role: SectorMiniStream, StreamId: ROOT_STREAM_ID, Path: "/"}, "mini stream", c.Directory.RootDirEntry().StartingSector)
+
+	entries := c.Walk()
+	for entry := entries.Next(); entry != nil; entry = entries.Next() {
+		dirEntry := c.Directory.DirEntries[entry.StreamId]
+		if !entry.IsStream() || c.isMiniStream(dirEntry) {
+			continue
+		}
+
+		follow(SectorClaim{Role: SectorStreamData, StreamId: entry.StreamId, Path: entry.Path}, entry.Path, dirEntry.StartingSector)
+	}
+
+	return entries.Err()
+}
+
+// Reports whether the FAT marks a sector free. A FAT entry that can't be
+// read doesn't count as free.
+func isFreeSector(allocator *Allocator, sectorId uint32) bool {
+	entry, err := allocator.FatEntry(sectorId)
+	return err == nil && entry == FREE_SECTOR
+}
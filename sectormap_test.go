@@ -0,0 +1,74 @@
+package mscfb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestSectorMap(t *testing.T) {
+	img := testFile{
+		version: V3,
+		entries: []testEntry{
+			{path: "/small", data: testPattern(1, 100)},
+			{path: "/a", data: testPattern(2, 5000)},
+			{path: "/b", data: testPattern(3, 5000)},
+		},
+	}.build(t)
+
+	cf, err := Open(bytes.NewReader(img.data), ValidationPermissive)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	// /a occupies sectors 0-9 and /b 10-19, followed by the directory,
+	// MiniFAT, mini stream and FAT.
+	wantRoles := map[uint32]SectorRole{
+		0:  SectorStreamData,
+		19: SectorStreamData,
+		20: SectorDirectory,
+		21: SectorMinifat,
+		22: SectorMiniStream,
+		23: SectorFat,
+	}
+	sectorMap, err := cf.SectorMap()
+	if err != nil {
+		t.Fatalf("SectorMap() error = %v", err)
+	}
+	if len(sectorMap) != 24 {
+		t.Fatalf("SectorMap() has %v entries, want 24", len(sectorMap))
+	}
+	for sectorId, role := range wantRoles {
+		if sectorMap[sectorId].Role != role {
+			t.Errorf("sector %v: Role = %v, want %v", sectorId, sectorMap[sectorId].Role, role)
+		}
+	}
+	claim := sectorMap[12].Claims[0]
+	if claim.Path != "/b" || claim.StreamId != img.dirIds["/b"] || claim.Offset != 2*512 {
+		t.Errorf("sector 12: claim = %+v", claim)
+	}
+
+	// Point the last sector of /a at the second sector of /b, so both
+	// streams claim sectors 11-19.
+	fatOffset := img.sectorOffset(img.fatStart)
+	binary.LittleEndian.PutUint32(img.data[fatOffset+9*4:], 11)
+	cf, err = Open(bytes.NewReader(img.data), ValidationPermissive)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	sectorMap, err = cf.SectorMap()
+	if err != nil {
+		t.Fatalf("SectorMap() error = %v", err)
+	}
+	if sectorMap[10].IsOverlapping() || !sectorMap[11].IsOverlapping() {
+		t.Errorf("IsOverlapping() = %v, %v for sectors 10, 11", sectorMap[10].IsOverlapping(), sectorMap[11].IsOverlapping())
+	}
+	paths := map[string]uint64{}
+	for _, claim := range sectorMap[11].Claims {
+		paths[claim.Path] = claim.Offset
+	}
+	if paths["/a"] != 10*512 || paths["/b"] != 512 {
+		t.Errorf("sector 11: claims = %+v", sectorMap[11].Claims)
+	}
+}
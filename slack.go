@@ -0,0 +1,82 @@
+package mscfb
+
+import (
+	"fmt"
+	"io"
+)
+
+// Returns the bytes between the end of the stream and the end of the last
+// sector, or mini sector, holding it. They are never read as part of the
+// stream, but often still hold data from an earlier version of it.
+func (s *Stream) Slack() ([]byte, error) {
+	if err := s.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	dirEntry := s.CompoundFile.Directory.DirEntries[s.StreamId]
+	if dirEntry.StreamSize == 0 {
+		return []byte{}, nil
+	}
+
+	chain, err := s.CompoundFile.openStreamChain(dirEntry)
+	if err != nil {
+		return nil, err
+	}
+
+	return readChainTail(chain, dirEntry.StreamSize)
+}
+
+// Returns the bytes between the end of the mini stream and the end of the
+// last sector holding it.
+func (c *CompoundFile) MiniStreamSlack() ([]byte, error) {
+	if err := c.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	rootEntry := c.Directory.RootDirEntry()
+	chain, err := c.Directory.Allocator.OpenChain(rootEntry.StartingSector, SectorInitFat)
+	if err != nil {
+		return nil, err
+	}
+
+	return readChainTail(chain, rootEntry.StreamSize)
+}
+
+// Returns the raw bytes of the directory following its last allocated entry,
+// i.e. the unallocated entries filling out the last directory sector(s).
+func (c *CompoundFile) DirectorySlack() ([]byte, error) {
+	if err := c.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	chain, err := c.Directory.Allocator.OpenChain(c.Directory.DirStartSector, SectorInitDir)
+	if err != nil {
+		return nil, err
+	}
+
+	used := 0
+	for i, dirEntry := range c.Directory.DirEntries {
+		if dirEntry.ObjType != ObjUnallocated {
+			used = i + 1
+		}
+	}
+
+	return readChainTail(chain, uint64(used*DIR_ENTRY_LEN))
+}
+
+// Reads a chain from offset to its end.
+func readChainTail(chain streamChain, offset uint64) ([]byte, error) {
+	if offset > chain.Len() {
+		return nil, fmt.Errorf("offset %v is past the end of the %v-byte chain", offset, chain.Len())
+	}
+
+	_, err := chain.Seek(int64(offset), io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	tail := make([]byte, chain.Len()-offset)
+	n, err := chain.ReadAll(tail)
+
+	return tail[:n], err
+}
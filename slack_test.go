@@ -0,0 +1,75 @@
+package mscfb
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSlack(t *testing.T) {
+	img := testFile{
+		version: V3,
+		entries: []testEntry{
+			{path: "/small", data: testPattern(1, 100)},
+			{path: "/large", data: testPattern(2, 5000)},
+		},
+	}.build(t)
+
+	// Find where both streams end and leave remnants past them.
+	cf, err := Open(bytes.NewReader(img.data), ValidationPermissive)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	large := cf.Directory.DirEntries[img.dirIds["/large"]]
+	lastSector := large.StartingSector + 9
+	largeRemnant := img.sectorOffset(lastSector) + 5000 - 9*512
+	copy(img.data[largeRemnant:], "large remnant")
+
+	root := cf.Directory.RootDirEntry()
+	smallRemnant := img.sectorOffset(root.StartingSector) + 100
+	copy(img.data[smallRemnant:], "small remnant")
+
+	cf, err = Open(bytes.NewReader(img.data), ValidationPermissive)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	tests := []struct {
+		path    string
+		wantLen int
+		want    string
+	}{
+		{path: "/small", wantLen: 128 - 100, want: "small remnant"},
+		{path: "/large", wantLen: 10*512 - 5000, want: "large remnant"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			stream, err := cf.OpenStream(tt.path)
+			if err != nil {
+				t.Fatalf("OpenStream() error = %v", err)
+			}
+			slack, err := stream.Slack()
+			if err != nil {
+				t.Fatalf("Slack() error = %v", err)
+			}
+			if len(slack) != tt.wantLen || !bytes.HasPrefix(slack, []byte(tt.want)) {
+				t.Errorf("Slack() = %q, want %v bytes starting with %q", slack, tt.wantLen, tt.want)
+			}
+		})
+	}
+
+	miniSlack, err := cf.MiniStreamSlack()
+	if err != nil {
+		t.Fatalf("MiniStreamSlack() error = %v", err)
+	}
+	if len(miniSlack) != 512-128 {
+		t.Errorf("MiniStreamSlack() returned %v bytes, want %v", len(miniSlack), 512-128)
+	}
+
+	dirSlack, err := cf.DirectorySlack()
+	if err != nil {
+		t.Fatalf("DirectorySlack() error = %v", err)
+	}
+	if len(dirSlack) != 512-3*DIR_ENTRY_LEN {
+		t.Errorf("DirectorySlack() returned %v bytes, want %v", len(dirSlack), 512-3*DIR_ENTRY_LEN)
+	}
+}
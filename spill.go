@@ -0,0 +1,79 @@
+package mscfb
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+)
+
+// Number of bytes OpenStream keeps in memory by default before spilling to
+// a temporary file.
+const DEFAULT_MAX_MEMORY = 32 << 20
+
+type StreamOptions struct {
+	// MaxMemory is the most bytes of the input kept in memory;
+	// DEFAULT_MAX_MEMORY if not set. Longer inputs are spilled to a
+	// temporary file.
+	MaxMemory int64
+	// TempDir is the directory for the temporary file; os.TempDir() if not
+	// set.
+	TempDir string
+
+	OpenOptions OpenOptions
+}
+
+// Opens a compound file from a reader that can't seek, such as a pipe or a
+// network connection, by reading it to the end first. Inputs of up to
+// MaxMemory bytes are buffered in memory; longer ones are written to a
+// temporary file, which Close removes. Close should be called either way.
+func OpenStream(r io.Reader, options StreamOptions) (*CompoundFile, error) {
+	maxMemory := options.MaxMemory
+	if maxMemory <= 0 {
+		maxMemory = DEFAULT_MAX_MEMORY
+	}
+
+	var buf bytes.Buffer
+	_, err := io.Copy(&buf, io.LimitReader(r, maxMemory+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(buf.Len()) <= maxMemory {
+		return OpenWithOptions(bytes.NewReader(buf.Bytes()), options.OpenOptions)
+	}
+
+	file, err := os.CreateTemp(options.TempDir, "mscfb-*.cfb")
+	if err != nil {
+		return nil, err
+	}
+	path := file.Name()
+
+	_, err = buf.WriteTo(file)
+	if err == nil {
+		_, err = io.Copy(file, r)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, err
+	}
+
+	cf, err := openFile(context.Background(), file, options.OpenOptions)
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	closer := cf.closer
+	cf.closer = func() error {
+		err := closer()
+		removeErr := os.Remove(path)
+		if err == nil {
+			err = removeErr
+		}
+		return err
+	}
+
+	return cf, nil
+}
@@ -0,0 +1,65 @@
+package mscfb
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestOpenStream(t *testing.T) {
+	entries := []testEntry{
+		{path: "/small", data: testPattern(1, 100)},
+		{path: "/large", data: testPattern(2, 10000)},
+	}
+	img := testFile{entries: entries}.build(t)
+
+	for _, maxMemory := range []int64{int64(len(img.data)), 4096} {
+		dir := t.TempDir()
+		r := struct{ io.Reader }{bytes.NewReader(img.data)}
+		cf, err := OpenStream(r, StreamOptions{MaxMemory: maxMemory, TempDir: dir})
+		if err != nil {
+			t.Fatalf("OpenStream() error = %v", err)
+		}
+
+		spilled := maxMemory < int64(len(img.data))
+		if files := tempFiles(t, dir); (len(files) == 1) != spilled {
+			t.Errorf("MaxMemory %v: temporary files = %v, spilled %v", maxMemory, files, spilled)
+		}
+
+		for _, e := range entries {
+			stream, err := cf.OpenStream(e.path)
+			if err != nil {
+				t.Fatalf("OpenStream(%v) error = %v", e.path, err)
+			}
+			got, err := io.ReadAll(stream)
+			if err != nil {
+				t.Fatalf("ReadAll() error = %v", err)
+			}
+			if !bytes.Equal(got, e.data) {
+				t.Errorf("MaxMemory %v: %v: read %v bytes not matching the stream", maxMemory, e.path, len(got))
+			}
+		}
+
+		if err := cf.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+		if files := tempFiles(t, dir); len(files) != 0 {
+			t.Errorf("MaxMemory %v: temporary files after Close() = %v", maxMemory, files)
+		}
+	}
+}
+
+func tempFiles(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	return names
+}
@@ -1,12 +1,20 @@
 package mscfb
 
 import (
+	"context"
 	"fmt"
 	"io"
 )
 
 const BUFFER_SIZE uint32 = 8192
 
+// streamChain is implemented by both Chain and MiniChain.
+type streamChain interface {
+	io.ReadSeeker
+	Len() uint64
+	ReadAll(p []byte) (int, error)
+}
+
 type Stream struct {
 	CompoundFile *CompoundFile
 
@@ -16,6 +24,14 @@ type Stream struct {
 	Position        uint64
 	Cap             uint64
 	OffsetFromStart uint64
+
+	// The chain holding the stream's data, resolved on the first read.
+	chain streamChain
+	// Set by Close.
+	closed bool
+	// Embedded compound files opened to reach the stream, innermost last,
+	// which Close closes along with it.
+	embedded []*CompoundFile
 }
 
 func newStream(comp *CompoundFile, streamId uint32) *Stream {
@@ -37,6 +53,10 @@ func (s *Stream) CurrentPosition() uint64 {
 }
 
 func (s *Stream) Read(p []byte) (int, error) {
+	if err := s.checkOpen(); err != nil {
+		return 0, err
+	}
+
 	bufData, err := s.fillBuf()
 	if err != nil {
 		return 0, err
@@ -60,11 +80,13 @@ func (s *Stream) fillBuf() ([]byte, error) {
 		s.Position = 0
 
 		cap, err := s.readDataFromStream()
-		if err != nil {
+		s.Cap = uint64(cap)
+
+		// Hand out whatever was read before the error; reading on from
+		// there will run into the same error again.
+		if err != nil && cap == 0 {
 			return nil, err
 		}
-
-		s.Cap = uint64(cap)
 	}
 
 	return s.Buffer[s.Position:s.Cap], nil
@@ -85,44 +107,77 @@ func (s *Stream) readDataFromStream() (int, error) {
 		}
 	}
 
-	if numBytes > 0 {
-		if dirEntry.StreamSize < uint64(MINI_STREAM_CUTOFF) {
-			chain, err := s.CompoundFile.MiniAlloc.OpenMiniChain(dirEntry.StartingSector)
-			if err != nil {
-				return 0, err
-			}
+	if numBytes == 0 {
+		return 0, nil
+	}
 
-			_, err = chain.Seek(int64(s.OffsetFromStart), io.SeekStart)
-			if err != nil {
-				return 0, err
-			}
+	chain, err := s.streamChain()
+	if err != nil {
+		return 0, err
+	}
 
-			_, err = chain.ReadAll(s.Buffer[:numBytes])
-			if err != nil {
-				return 0, err
-			}
-		} else {
-			chain, err := s.CompoundFile.Directory.Allocator.OpenChain(dirEntry.StartingSector, SectorInitZero)
-			if err != nil {
-				return 0, err
-			}
+	if s.OffsetFromStart >= chain.Len() {
+		return 0, s.shortChainError(chain.Len())
+	}
 
-			_, err = chain.Seek(int64(s.OffsetFromStart), io.SeekStart)
-			if err != nil {
-				return 0, err
-			}
+	_, err = chain.Seek(int64(s.OffsetFromStart), io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
 
-			_, err = chain.ReadAll(s.Buffer[:numBytes])
-			if err != nil {
-				return 0, err
-			}
+	n, err := chain.ReadAll(s.Buffer[:numBytes])
+	if err == nil && n < numBytes {
+		err = s.shortChainError(chain.Len())
+	}
+
+	return n, err
+}
+
+// Returns the chain holding the stream's data, opening it on first use.
+func (s *Stream) streamChain() (streamChain, error) {
+	if s.chain == nil {
+		chain, err := s.CompoundFile.openStreamChain(s.CompoundFile.Directory.DirEntries[s.StreamId])
+		if err != nil {
+			return nil, err
 		}
+		s.chain = chain
 	}
 
-	return numBytes, nil
+	return s.chain, nil
+}
+
+// Reports whether an entry's data is kept in the mini stream, which is the
+// case for streams below the mini stream cutoff. The root entry's data is
+// the mini stream itself, so it is always in regular sectors.
+func (c *CompoundFile) isMiniStream(dirEntry *DirEntry) bool {
+	return dirEntry.ObjType != ObjRoot && dirEntry.StreamSize < uint64(c.Header.MiniStreamCutoff)
+}
+
+// Opens the chain holding a stream's data: a MiniChain for streams in the
+// mini stream, a Chain otherwise.
+func (c *CompoundFile) openStreamChain(dirEntry *DirEntry) (streamChain, error) {
+	if c.isMiniStream(dirEntry) {
+		return c.MiniAlloc.OpenMiniChain(dirEntry.StartingSector)
+	}
+
+	return c.Directory.Allocator.OpenChain(dirEntry.StartingSector, SectorInitZero)
+}
+
+func (s *Stream) shortChainError(chainLen uint64) error {
+	if s.CompoundFile.Directory.Allocator.Sectors.Truncated() {
+		return fmt.Errorf("stream %v ends after %v of %v bytes: %w",
+			s.StreamId, chainLen, s.TotalLen, ErrTruncated)
+	}
+
+	return fmt.Errorf("stream %v has %v bytes, but its chain holds only %v",
+		s.StreamId, s.TotalLen, chainLen)
 }
 
 func (s *Stream) Seek(pos int64, whence int) (int64, error) {
+	if err := s.checkOpen(); err != nil {
+		return 0, err
+	}
+
 	delta := pos
 	var newPos int64
 
@@ -176,3 +231,97 @@ func (s *Stream) Seek(pos int64, whence int) (int64, error) {
 
 	return newPos, nil
 }
+
+// Upper bound on a single read by WriteTo.
+const writeToChunkLen = 1 << 20
+
+// Writes the rest of the stream to w. Rather than going through the read
+// buffer a sector at a time, it follows the stream's chain directly and
+// reads each run of physically contiguous sectors at once, in chunks of up
+// to 1 MiB. Files mapped by OpenFile are written straight from the mapping.
+func (s *Stream) WriteTo(w io.Writer) (int64, error) {
+	return s.WriteToContext(context.Background(), w)
+}
+
+// Like WriteTo, but stops with ctx's error if ctx is cancelled, checking
+// before each run of sectors or chunk of a run is read. The stream is left
+// positioned after the bytes written.
+func (s *Stream) WriteToContext(ctx context.Context, w io.Writer) (int64, error) {
+	if err := s.checkOpen(); err != nil {
+		return 0, err
+	}
+
+	pos := s.CurrentPosition()
+	if pos >= s.TotalLen {
+		return 0, nil
+	}
+
+	extents, err := s.CompoundFile.streamExtents(s.StreamId)
+	if err != nil {
+		return 0, err
+	}
+
+	sectors := s.CompoundFile.Directory.Allocator.Sectors
+	var buf []byte
+	var written int64
+	var copyErr error
+
+	for _, extent := range extents {
+		end := extent.StreamOffset + extent.Length
+		if end <= pos {
+			continue
+		}
+
+		skip := uint64(0)
+		if extent.StreamOffset < pos {
+			skip = pos - extent.StreamOffset
+		}
+		fileOffset := extent.FileOffset + int64(skip)
+		length := int64(extent.Length - skip)
+
+		for length > 0 {
+			copyErr = ctx.Err()
+			if copyErr != nil {
+				break
+			}
+
+			n := min(uint64(length), writeToChunkLen)
+			if sectors.data == nil && buf == nil {
+				buf = make([]byte, min(s.TotalLen-pos, writeToChunkLen))
+			}
+
+			var chunk []byte
+			chunk, copyErr = sectors.readRange(fileOffset, int(n), buf)
+			if len(chunk) > 0 {
+				m, err := w.Write(chunk)
+				written += int64(m)
+				if err == nil && m < len(chunk) {
+					err = io.ErrShortWrite
+				}
+				if err != nil {
+					copyErr = err
+				}
+			}
+			if copyErr != nil {
+				break
+			}
+
+			fileOffset += int64(n)
+			length -= int64(n)
+		}
+		if copyErr != nil {
+			break
+		}
+	}
+
+	if copyErr == ErrTruncated || (copyErr == nil && pos+uint64(written) < s.TotalLen) {
+		copyErr = s.shortChainError(pos + uint64(written))
+	}
+
+	_, err = s.Seek(int64(pos)+written, io.SeekStart)
+	if copyErr == nil {
+		copyErr = err
+	}
+
+	return written, copyErr
+}
@@ -0,0 +1,299 @@
+package mscfb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Reading a stream should cost the same per byte however long it is.
+func BenchmarkStreamRead(b *testing.B) {
+	for _, size := range []int{64 << 10, 1 << 20, 8 << 20} {
+		img := testFile{entries: []testEntry{
+			{path: "/data", data: testPattern(1, size)},
+		}}.build(b)
+
+		b.Run(fmt.Sprintf("%vKiB", size>>10), func(b *testing.B) {
+			benchmarkReadStreams(b, img, []string{"/data"}, OpenOptions{})
+		})
+	}
+}
+
+// Reading small streams should cost the same per byte however large the
+// mini stream holding them is.
+func BenchmarkMiniStreamRead(b *testing.B) {
+	for _, count := range []int{16, 256, 2048} {
+		entries := make([]testEntry, count)
+		paths := make([]string, count)
+		for i := range entries {
+			paths[i] = fmt.Sprintf("/small%05d", i)
+			entries[i] = testEntry{path: paths[i], data: testPattern(i, 3000)}
+		}
+		img := testFile{entries: entries}.build(b)
+
+		b.Run(fmt.Sprintf("%vStreams", count), func(b *testing.B) {
+			benchmarkReadStreams(b, img, paths[:16], OpenOptions{})
+		})
+		b.Run(fmt.Sprintf("%vStreamsFile", count), func(b *testing.B) {
+			benchmarkReadFileStreams(b, img, paths[:16], OpenOptions{})
+		})
+		b.Run(fmt.Sprintf("%vStreamsFileCached", count), func(b *testing.B) {
+			benchmarkReadFileStreams(b, img, paths[:16], OpenOptions{SectorCacheBytes: 1 << 20})
+		})
+	}
+}
+
+// Reads from a file on disk, where the sector cache saves a system call per
+// mini sector read.
+func benchmarkReadFileStreams(b *testing.B, img *testImage, paths []string, options OpenOptions) {
+	path := filepath.Join(b.TempDir(), "bench.cfb")
+	if err := os.WriteFile(path, img.data, 0o644); err != nil {
+		b.Fatalf("WriteFile() error = %v", err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		b.Fatalf("Open() error = %v", err)
+	}
+	defer file.Close()
+
+	benchmarkReadStreamsFrom(b, file, paths, options)
+}
+
+func benchmarkReadStreams(b *testing.B, img *testImage, paths []string, options OpenOptions) {
+	benchmarkReadStreamsFrom(b, bytes.NewReader(img.data), paths, options)
+}
+
+func benchmarkReadStreamsFrom(b *testing.B, reader io.ReadSeeker, paths []string, options OpenOptions) {
+	cf, err := OpenWithOptions(reader, options)
+	if err != nil {
+		b.Fatalf("OpenWithOptions() error = %v", err)
+	}
+
+	streams := make([]*Stream, len(paths))
+	openStreams := func() {
+		for i, path := range paths {
+			streams[i], err = cf.OpenStream(path)
+			if err != nil {
+				b.Fatalf("OpenStream() error = %v", err)
+			}
+		}
+	}
+
+	openStreams()
+	var total int64
+	for _, stream := range streams {
+		total += int64(stream.TotalLen)
+	}
+
+	// Only reading is timed, not looking up the streams; fresh streams are
+	// opened each time so their chains are resolved anew.
+	b.SetBytes(total)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		openStreams()
+		b.StartTimer()
+
+		for _, stream := range streams {
+			if _, err := io.Copy(io.Discard, stream); err != nil {
+				b.Fatalf("Copy() error = %v", err)
+			}
+		}
+	}
+}
+
+// A stream resolves its chain on the first read and keeps using it however
+// it is read and sought afterwards.
+func TestStreamChainReused(t *testing.T) {
+	want := map[string][]byte{
+		"/small": testPattern(1, 3000),
+		"/large": testPattern(2, 3*int(BUFFER_SIZE)+100),
+	}
+	img := testFile{entries: []testEntry{
+		{path: "/small", data: want["/small"]},
+		{path: "/large", data: want["/large"]},
+	}}.build(t)
+
+	cf, err := Open(bytes.NewReader(img.data), ValidationStrict)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	for path, data := range want {
+		stream, err := cf.OpenStream(path)
+		if err != nil {
+			t.Fatalf("OpenStream(%v) error = %v", path, err)
+		}
+		if stream.chain != nil {
+			t.Fatalf("%v: chain resolved before the first read", path)
+		}
+
+		buf := make([]byte, 1000)
+		if _, err := io.ReadFull(stream, buf); err != nil {
+			t.Fatalf("%v: Read() error = %v", path, err)
+		}
+		chain := stream.chain
+		if chain == nil {
+			t.Fatalf("%v: chain not resolved by the first read", path)
+		}
+
+		// Forwards past the buffer, backwards to the start and into the
+		// middle of a buffer, then read to the end.
+		for _, offset := range []int64{int64(len(data)) - 500, 0, 1500, 10, int64(len(data)) / 2} {
+			if _, err := stream.Seek(offset, io.SeekStart); err != nil {
+				t.Fatalf("%v: Seek(%v) error = %v", path, offset, err)
+			}
+			n, err := io.ReadFull(stream, buf)
+			if err != nil && err != io.ErrUnexpectedEOF {
+				t.Fatalf("%v: Read() at %v error = %v", path, offset, err)
+			}
+			if !bytes.Equal(buf[:n], data[offset:offset+int64(n)]) {
+				t.Errorf("%v: Read() at %v doesn't match the stream", path, offset)
+			}
+			if stream.chain != chain {
+				t.Errorf("%v: chain resolved again after seeking to %v", path, offset)
+			}
+		}
+
+		rest, err := io.ReadAll(stream)
+		if err != nil {
+			t.Fatalf("%v: ReadAll() error = %v", path, err)
+		}
+		if offset := len(data)/2 + len(buf); !bytes.Equal(rest, data[offset:]) {
+			t.Errorf("%v: ReadAll() doesn't match the rest of the stream", path)
+		}
+		if stream.chain != chain {
+			t.Errorf("%v: chain resolved again", path)
+		}
+	}
+}
+
+// countingReader counts the reads made from the underlying reader.
+type countingReader struct {
+	io.ReadSeeker
+	reads int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	r.reads++
+	return r.ReadSeeker.Read(p)
+}
+
+func TestStreamWriteTo(t *testing.T) {
+	entries := []testEntry{
+		{path: "/small", data: testPattern(1, 3000)},
+		{path: "/large", data: testPattern(2, 70000)},
+	}
+
+	for _, version := range []Version{V3, V4} {
+		img := testFile{version: version, entries: entries}.build(t)
+		reader := &countingReader{ReadSeeker: bytes.NewReader(img.data)}
+		cf, err := Open(reader, ValidationStrict)
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+
+		for _, e := range entries {
+			stream, err := cf.OpenStream(e.path)
+			if err != nil {
+				t.Fatalf("OpenStream(%v) error = %v", e.path, err)
+			}
+
+			// Start from within the read buffer.
+			head := make([]byte, 10)
+			if _, err := io.ReadFull(stream, head); err != nil {
+				t.Fatalf("ReadFull() error = %v", err)
+			}
+
+			reader.reads = 0
+			var out bytes.Buffer
+			n, err := stream.WriteTo(&out)
+			if err != nil {
+				t.Fatalf("WriteTo() error = %v", err)
+			}
+			if n != int64(len(e.data)-10) || !bytes.Equal(out.Bytes(), e.data[10:]) {
+				t.Errorf("v%v %v: WriteTo() wrote %v bytes not matching the stream", version, e.path, n)
+			}
+			// Both streams are stored contiguously.
+			if reader.reads != 1 {
+				t.Errorf("v%v %v: WriteTo() made %v reads, want 1", version, e.path, reader.reads)
+			}
+			if _, err := stream.Read(head); err != io.EOF {
+				t.Errorf("v%v %v: Read() after WriteTo() error = %v, want EOF", version, e.path, err)
+			}
+		}
+	}
+}
+
+func TestStreamWriteToTruncated(t *testing.T) {
+	entries := []testEntry{
+		{path: "/large", data: testPattern(1, 20000)},
+	}
+	img := testFile{version: V3, entries: entries, metaFirst: true}.build(t)
+	cut := len(img.data) - 5000
+
+	cf, err := OpenWithOptions(bytes.NewReader(img.data[:cut]), OpenOptions{Recover: true})
+	if err != nil {
+		t.Fatalf("OpenWithOptions() error = %v", err)
+	}
+	stream, err := cf.OpenStream("/large")
+	if err != nil {
+		t.Fatalf("OpenStream() error = %v", err)
+	}
+
+	var out bytes.Buffer
+	_, err = stream.WriteTo(&out)
+	if !errors.Is(err, ErrTruncated) {
+		t.Errorf("WriteTo() error = %v, want %v", err, ErrTruncated)
+	}
+	// The stream's last sector ends with 480 bytes of padding.
+	want := entries[0].data[:len(entries[0].data)-(5000-480)]
+	if !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("WriteTo() wrote %v bytes, want the first %v", out.Len(), len(want))
+	}
+}
+
+// Compares copying a stream through Read with copying it through WriteTo.
+func BenchmarkStreamWriteTo(b *testing.B) {
+	img := testFile{entries: []testEntry{
+		{path: "/data", data: testPattern(1, 8<<20)},
+	}}.build(b)
+	path := filepath.Join(b.TempDir(), "bench.cfb")
+	if err := os.WriteFile(path, img.data, 0o644); err != nil {
+		b.Fatalf("WriteFile() error = %v", err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		b.Fatalf("Open() error = %v", err)
+	}
+	defer file.Close()
+
+	cf, err := Open(file, ValidationPermissive)
+	if err != nil {
+		b.Fatalf("Open() error = %v", err)
+	}
+
+	for _, mode := range []string{"Read", "WriteTo"} {
+		b.Run(mode, func(b *testing.B) {
+			b.SetBytes(8 << 20)
+			for i := 0; i < b.N; i++ {
+				stream, err := cf.OpenStream("/data")
+				if err != nil {
+					b.Fatalf("OpenStream() error = %v", err)
+				}
+
+				var src io.Reader = stream
+				if mode == "Read" {
+					src = struct{ io.Reader }{stream}
+				}
+				if _, err := io.Copy(io.Discard, src); err != nil {
+					b.Fatalf("Copy() error = %v", err)
+				}
+			}
+		})
+	}
+}
@@ -1 +1,48 @@
 package mscfb
+
+import (
+	"math"
+	"time"
+)
+
+// Number of 100-nanosecond intervals between the FILETIME epoch
+// (1601-01-01) and the Unix epoch.
+const filetimeUnixOffset = 116444736000000000
+
+// Converts a FILETIME, as stored in directory entries, to a time. A zero
+// FILETIME means the timestamp isn't set and converts to the zero time.
+func TimeFromFiletime(filetime uint64) time.Time {
+	if filetime == 0 {
+		return time.Time{}
+	}
+
+	// Whole seconds always fit in an int64, where the intervals may not.
+	seconds := int64(filetime/1e7) - filetimeUnixOffset/1e7
+	nanoseconds := int64(filetime%1e7) * 100
+
+	return time.Unix(seconds, nanoseconds).UTC()
+}
+
+// Converts a time to a FILETIME. The zero time converts to zero, and other
+// times outside the range of a FILETIME are clamped to it.
+func FiletimeFromTime(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	seconds := t.Unix() + filetimeUnixOffset/1e7
+	switch {
+	case seconds < 0:
+		return 1
+	case uint64(seconds) > math.MaxUint64/uint64(1e7):
+		return math.MaxUint64
+	}
+
+	filetime := uint64(seconds) * 1e7
+	intervals := uint64(t.Nanosecond() / 100)
+	if filetime > math.MaxUint64-intervals {
+		return math.MaxUint64
+	}
+
+	return filetime + intervals
+}